@@ -0,0 +1,78 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"go-mod.ewintr.nl/yogai/model"
+	"go-mod.ewintr.nl/yogai/storage"
+	"github.com/google/uuid"
+)
+
+const apiKeyUsage = `usage:
+  yogai apikey create <name> [read|write|admin]
+  yogai apikey revoke <id>
+  yogai apikey list`
+
+// runAPIKey manages the api keys from the command line. It uses the same
+// POSTGRES_* variables as the service.
+func runAPIKey(args []string) error {
+	if len(args) == 0 {
+		return errors.New(apiKeyUsage)
+	}
+
+	postgres, err := storage.NewPostgres(postgresInfo())
+	if err != nil {
+		return fmt.Errorf("unable to connect to postgres: %w", err)
+	}
+	keyRepo := storage.NewPostgresAPIKeyRepository(postgres)
+
+	switch {
+	case args[0] == "create" && (len(args) == 2 || len(args) == 3):
+		scope := model.ScopeRead
+		if len(args) == 3 {
+			if scope, err = model.ParseScope(args[2]); err != nil {
+				return err
+			}
+		}
+		key, token, err := model.NewAPIKey(args[1], scope)
+		if err != nil {
+			return fmt.Errorf("unable to generate key: %w", err)
+		}
+		if err := keyRepo.Save(key); err != nil {
+			return fmt.Errorf("unable to save key: %w", err)
+		}
+		fmt.Printf("created key %s with scope %s\n", key.ID, key.Scope)
+		fmt.Printf("token, this is shown only once: %s\n", token)
+	case args[0] == "revoke" && len(args) == 2:
+		id, err := uuid.Parse(args[1])
+		if err != nil {
+			return fmt.Errorf("invalid key id: %w", err)
+		}
+		if err := keyRepo.Revoke(id); err != nil {
+			return fmt.Errorf("unable to revoke key: %w", err)
+		}
+		fmt.Printf("revoked key %s\n", id)
+	case args[0] == "list" && len(args) == 1:
+		keys, err := keyRepo.FindAll()
+		if err != nil {
+			return fmt.Errorf("unable to find keys: %w", err)
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tNAME\tSCOPE\tCREATED\tREVOKED")
+		for _, k := range keys {
+			revoked := "-"
+			if k.Revoked() {
+				revoked = k.RevokedAt.Format("2006-01-02 15:04")
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", k.ID, k.Name, k.Scope, k.CreatedAt.Format("2006-01-02 15:04"), revoked)
+		}
+		return tw.Flush()
+	default:
+		return errors.New(apiKeyUsage)
+	}
+
+	return nil
+}
@@ -11,9 +11,36 @@ type FeedEntry struct {
 
 type ChannelReader interface {
 	Search(channelID model.YoutubeChannelID, pageToken string) ([]model.YoutubeVideoID, string, error)
+	FetchChannels(channelIDs []model.YoutubeChannelID) (map[model.YoutubeChannelID]ChannelMetadata, error)
+}
+
+// PlaylistEntry is a video in a playlist. The video can be from any channel.
+type PlaylistEntry struct {
+	YoutubeID        model.YoutubeVideoID
+	YoutubeChannelID model.YoutubeChannelID
+	Position         int64
+}
+
+type PlaylistReader interface {
+	PlaylistItems(playlistID model.YoutubePlaylistID, pageToken string) ([]PlaylistEntry, string, error)
+	FetchPlaylists(playlistIDs []model.YoutubePlaylistID) (map[model.YoutubePlaylistID]PlaylistMetadata, error)
 }
 
 type FeedReader interface {
 	Unread() ([]FeedEntry, error)
 	MarkRead(feedID int64) error
 }
+
+// Subscription is a YouTube channel or playlist that is followed in the feed
+// reader
+type Subscription struct {
+	FeedID            int64
+	Source            model.FeedSource
+	YoutubeChannelID  model.YoutubeChannelID
+	YoutubePlaylistID model.YoutubePlaylistID
+}
+
+type SubscriptionManager interface {
+	Subscriptions() ([]Subscription, error)
+	Subscribe(feed *model.Feed) error
+}
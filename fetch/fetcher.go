@@ -1,72 +1,92 @@
 package fetch
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"time"
 
+	"go-mod.ewintr.nl/yogai/metrics"
 	"go-mod.ewintr.nl/yogai/model"
 	"go-mod.ewintr.nl/yogai/storage"
+	"go-mod.ewintr.nl/yogai/tracing"
 	"github.com/google/uuid"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/exp/slog"
 )
 
+var tracer = otel.Tracer("go-mod.ewintr.nl/yogai/fetch")
+
+const (
+	metadataBatchSize  = 50
+	channelBatchSize   = 50
+	playlistBatchSize  = 50
+	feedVisibility     = time.Hour
+	metadataVisibility = 5 * time.Minute
+	channelCheck       = time.Hour
+	statisticsCheck    = 10 * time.Minute
+	statisticsLimit    = 1000
+	recheckCheck       = time.Hour
+	// airedMargin gives YouTube time to process a premiere or stream after it
+	// has aired
+	airedMargin = 15 * time.Minute
+)
+
 type Fetcher struct {
 	interval        time.Duration
+	pollInterval    time.Duration
+	channelRefresh  time.Duration
+	statsRefresh    time.Duration
+	recheck         time.Duration
 	feedRepo        storage.FeedRelRepository
 	videoRepo       storage.VideoRelRepository
+	eventRepo       storage.VideoEventRepository
+	playlistRepo    storage.PlaylistRepository
+	queue           storage.JobQueue
 	feedReader      FeedReader
 	channelReader   ChannelReader
+	playlistReader  PlaylistReader
 	metadataFetcher MetadataFetcher
-	feedPipeline    chan *model.Feed
-	videoPipeline   chan *model.Video
-	needsMetadata   chan *model.Video
-	out             chan *model.Video
 	logger          *slog.Logger
 }
 
-func NewFetch(feedRepo storage.FeedRelRepository, videoRepo storage.VideoRelRepository, channelReader ChannelReader, feedReader FeedReader, interval time.Duration, metadataFetcher MetadataFetcher, logger *slog.Logger) *Fetcher {
+// NewFetch creates the fetcher. interval is the time between reads of the feed
+// reader, channelRefresh and statsRefresh the age at which the metadata of a
+// channel or playlist and the statistics of a video are fetched again, and
+// recheck the time after which an unavailable video is looked up again.
+func NewFetch(feedRepo storage.FeedRelRepository, videoRepo storage.VideoRelRepository, eventRepo storage.VideoEventRepository, playlistRepo storage.PlaylistRepository, queue storage.JobQueue, channelReader ChannelReader, playlistReader PlaylistReader, feedReader FeedReader, interval, channelRefresh, statsRefresh, recheck time.Duration, metadataFetcher MetadataFetcher, logger *slog.Logger) *Fetcher {
 	return &Fetcher{
 		interval:        interval,
+		pollInterval:    10 * time.Second,
+		channelRefresh:  channelRefresh,
+		statsRefresh:    statsRefresh,
+		recheck:         recheck,
 		feedRepo:        feedRepo,
 		videoRepo:       videoRepo,
+		eventRepo:       eventRepo,
+		playlistRepo:    playlistRepo,
+		queue:           queue,
 		channelReader:   channelReader,
+		playlistReader:  playlistReader,
 		feedReader:      feedReader,
 		metadataFetcher: metadataFetcher,
-		feedPipeline:    make(chan *model.Feed, 10),
-		videoPipeline:   make(chan *model.Video, 10),
-		needsMetadata:   make(chan *model.Video, 10),
-		out:             make(chan *model.Video),
 		logger:          logger,
 	}
 }
 
 func (f *Fetcher) Run() {
-	go f.FetchHistoricalVideos()
 	go f.FindNewFeeds()
-
-	go f.ReadFeeds()
-	go f.MetadataFetcher()
 	go f.FindUnprocessed()
 
-	f.logger.Info("started videoPipeline")
-	for {
-		select {
-		case video := <-f.videoPipeline:
-			if err := f.videoRepo.Save(video); err != nil {
-				f.logger.Error("failed to save video in normal db", err)
-				continue
-			}
-			switch video.Status {
-			case model.StatusNew:
-				f.needsMetadata <- video
-			case model.StatusFetched:
-				f.out <- video
-			}
-		}
-	}
-}
+	go f.FetchHistoricalVideos()
+	go f.MetadataFetcher()
+	go f.RefreshFeeds()
+	go f.RefreshStatistics()
+	go f.RecheckUnavailable()
 
-func (f *Fetcher) Out() chan *model.Video {
-	return f.out
+	f.ReadFeeds()
 }
 
 func (f *Fetcher) FindNewFeeds() {
@@ -77,55 +97,423 @@ func (f *Fetcher) FindNewFeeds() {
 		return
 	}
 	for _, feed := range feeds {
-		f.feedPipeline <- feed
+		if err := f.queue.Enqueue(model.QueueFeed, feed.ID, model.PriorityNormal); err != nil {
+			f.logger.Error("failed to enqueue feed", err)
+		}
+	}
+}
+
+// AddFeed saves a new channel or playlist feed and queues it for the
+// historical fetch. An ad hoc feed of the channel becomes a full feed, for
+// other existing feeds it returns storage.ErrExists.
+func (f *Fetcher) AddFeed(feed *model.Feed) error {
+	var existing *model.Feed
+	var err error
+	switch feed.Source {
+	case model.FeedSourceChannel:
+		existing, err = f.feedRepo.FindByYoutubeChannelID(feed.YoutubeChannelID)
+	case model.FeedSourcePlaylist:
+		existing, err = f.feedRepo.FindByYoutubePlaylistID(feed.YoutubePlaylistID)
+	default:
+		return fmt.Errorf("unknown feed source %q", feed.Source)
+	}
+	switch {
+	case err == nil && existing.Status == model.FeedStatusAdHoc:
+		*feed = *existing
+	case err == nil:
+		return storage.ErrExists
+	case !errors.Is(err, storage.ErrNotFound):
+		return err
+	default:
+		feed.ID = uuid.New()
+	}
+
+	feed.Status = model.FeedStatusNew
+	if err := f.feedRepo.Save(feed); err != nil {
+		return err
+	}
+
+	return f.queue.Enqueue(model.QueueFeed, feed.ID, model.PriorityHigh)
+}
+
+// AddVideo adds a single video and queues it for metadata fetching. If the
+// channel of the video has no feed yet, an ad hoc feed is created for it,
+// which does not fetch the other videos of the channel. The video types and
+// rules of the feed do not apply to the video, it was asked for explicitly.
+// It returns the existing video and storage.ErrExists if the video is already
+// there, and storage.ErrNotFound if YouTube does not know it.
+func (f *Fetcher) AddVideo(ytID model.YoutubeVideoID, actor string) (*model.Video, error) {
+	video, err := f.videoRepo.FindByYoutubeID(ytID)
+	switch {
+	case err == nil:
+		return video, storage.ErrExists
+	case !errors.Is(err, storage.ErrNotFound):
+		return nil, err
+	}
+
+	ctx, span := tracer.Start(context.Background(), "fetch.add_video", trace.WithAttributes(attribute.String("yogai.video.youtube_id", string(ytID))))
+	defer span.End()
+
+	// the channel is needed for the feed
+	mds, err := f.metadataFetcher.FetchMetadata([]model.YoutubeVideoID{ytID})
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+	md, ok := mds[ytID]
+	if !ok {
+		return nil, storage.ErrNotFound
+	}
+
+	_, err = f.feedRepo.FindByYoutubeChannelID(md.ChannelID)
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		feed := &model.Feed{
+			ID:               uuid.New(),
+			Status:           model.FeedStatusAdHoc,
+			Source:           model.FeedSourceChannel,
+			YoutubeChannelID: md.ChannelID,
+		}
+		if err := f.feedRepo.Save(feed); err != nil {
+			span.RecordError(err)
+			return nil, err
+		}
+		f.logger.Info("added ad hoc feed", slog.String("channelid", string(md.ChannelID)))
+	case err != nil:
+		span.RecordError(err)
+		return nil, err
+	}
+
+	video = &model.Video{
+		ID:               uuid.New(),
+		Status:           model.StatusNew,
+		YoutubeID:        ytID,
+		YoutubeChannelID: md.ChannelID,
+		Requested:        true,
 	}
+	if !f.addVideo(ctx, video, model.PriorityHigh, actor) {
+		return nil, fmt.Errorf("could not add video %s", ytID)
+	}
+
+	return video, nil
 }
 
 func (f *Fetcher) FetchHistoricalVideos() {
 	f.logger.Info("started historical video fetch")
 
-	for feed := range f.feedPipeline {
-		f.logger.Info("fetching historical videos", slog.String("channelid", string(feed.YoutubeChannelID)))
-		token := ""
-		for {
-			token = f.FetchHistoricalVideoPage(feed.YoutubeChannelID, token)
-			if token == "" {
-				break
+	for {
+		metrics.FetchIterations.WithLabelValues("historical").Inc()
+		jobs, err := f.queue.Lease(model.QueueFeed, 1, feedVisibility)
+		if err != nil {
+			metrics.FetchErrors.WithLabelValues("historical").Inc()
+			f.logger.Error("failed to lease feed jobs", err)
+		}
+		if len(jobs) == 0 {
+			time.Sleep(f.pollInterval)
+			continue
+		}
+
+		job := jobs[0]
+		feed, err := f.feedRepo.FindByID(job.SubjectID)
+		if err != nil {
+			metrics.FetchErrors.WithLabelValues("historical").Inc()
+			f.logger.Error("failed to find feed", err)
+			f.nack(job, err)
+			continue
+		}
+
+		f.logger.Info("fetching historical videos", slog.String("channelid", string(feed.YoutubeChannelID)), slog.String("playlistid", string(feed.YoutubePlaylistID)))
+		ctx, span := tracer.Start(context.Background(), "fetch.historical", trace.WithAttributes(attribute.String("yogai.channel.id", string(feed.YoutubeChannelID)), attribute.String("yogai.playlist.id", string(feed.YoutubePlaylistID))))
+		if feed.RefreshedAt == nil {
+			f.refreshFeeds(ctx, []*model.Feed{feed})
+		}
+		if feed.Source == model.FeedSourcePlaylist {
+			if err := f.syncPlaylist(ctx, feed); err != nil {
+				metrics.FetchErrors.WithLabelValues("historical").Inc()
+				f.logger.Error("failed to fetch playlist", err)
+				f.nack(job, err)
+				tracing.End(span, err)
+				continue
+			}
+		} else {
+			token := ""
+			for {
+				token, err = f.FetchHistoricalVideoPage(ctx, feed.YoutubeChannelID, token)
+				if err != nil || token == "" {
+					break
+				}
+			}
+			if err != nil {
+				f.nack(job, err)
+				tracing.End(span, err)
+				continue
 			}
 		}
 		feed.Status = model.FeedStatusReady
-		if err := f.feedRepo.Save(feed); err != nil {
+		if err := f.feedRepo.SaveStatus(feed); err != nil {
+			metrics.FetchErrors.WithLabelValues("historical").Inc()
 			f.logger.Error("failed to save feed", err)
+			f.nack(job, err)
+			tracing.End(span, err)
 			continue
 		}
+		f.ack(job)
+		span.End()
 	}
 }
 
-func (f *Fetcher) FetchHistoricalVideoPage(channelID model.YoutubeChannelID, pageToken string) string {
+// FetchHistoricalVideoPage adds the videos of one page of search results and
+// returns the token of the next page, which is empty after the last page.
+// Videos that are already known are left alone, so a failed backfill can start
+// over from the first page.
+func (f *Fetcher) FetchHistoricalVideoPage(ctx context.Context, channelID model.YoutubeChannelID, pageToken string) (string, error) {
 	f.logger.Info("fetching historical video page", slog.String("channelid", string(channelID)), slog.String("pagetoken", pageToken))
+	ctx, span := tracer.Start(ctx, "fetch.historical_page")
+	defer span.End()
 	ytIDs, pageToken, err := f.channelReader.Search(channelID, pageToken)
 	if err != nil {
+		metrics.FetchErrors.WithLabelValues("historical").Inc()
 		f.logger.Error("failed to fetch channel", err)
-		return ""
+		span.RecordError(err)
+		return "", err
 	}
 	for _, ytID := range ytIDs {
+		_, err := f.videoRepo.FindByYoutubeID(ytID)
+		switch {
+		case err == nil:
+			continue
+		case !errors.Is(err, storage.ErrNotFound):
+			metrics.FetchErrors.WithLabelValues("historical").Inc()
+			span.RecordError(err)
+			return "", err
+		}
 		video := &model.Video{
 			ID:               uuid.New(),
 			Status:           model.StatusNew,
 			YoutubeID:        ytID,
 			YoutubeChannelID: channelID,
 		}
-		if err := f.videoRepo.Save(video); err != nil {
-			f.logger.Error("failed to save video", err)
+		f.addVideo(ctx, video, model.PriorityNormal, "historical fetch")
+	}
+
+	f.logger.Info("fetched historical video page", slog.String("channelid", string(channelID)), slog.String("pagetoken", pageToken), slog.Int("count", len(ytIDs)))
+	return pageToken, nil
+}
+
+// RefreshFeeds fetches the metadata of channels and playlists that have none
+// yet, or where it is older than the refresh interval. The videos of playlists
+// are read again as well, to find the ones that were added, moved or removed.
+// New feeds are left to the historical fetch, which also saves them.
+func (f *Fetcher) RefreshFeeds() {
+	f.logger.Info("started feed refresh")
+	for {
+		metrics.FetchIterations.WithLabelValues("channels").Inc()
+		found, err := f.feedRepo.FindRefreshedBefore(time.Now().Add(-f.channelRefresh))
+		if err != nil {
+			metrics.FetchErrors.WithLabelValues("channels").Inc()
+			f.logger.Error("failed to find feeds to refresh", err)
+		}
+		feeds := make([]*model.Feed, 0, len(found))
+		for _, feed := range found {
+			if feed.Status != model.FeedStatusNew {
+				feeds = append(feeds, feed)
+			}
+		}
+		if len(feeds) > 0 {
+			ctx, span := tracer.Start(context.Background(), "fetch.feeds", trace.WithAttributes(attribute.Int("yogai.feeds", len(feeds))))
+			f.refreshFeeds(ctx, feeds)
+			for _, feed := range feeds {
+				if feed.Source != model.FeedSourcePlaylist {
+					continue
+				}
+				if err := f.syncPlaylist(ctx, feed); err != nil {
+					metrics.FetchErrors.WithLabelValues("playlists").Inc()
+					f.logger.Error("failed to sync playlist", err, slog.String("playlistid", string(feed.YoutubePlaylistID)))
+				}
+			}
+			span.End()
+			f.logger.Info("refreshed feeds", slog.Int("count", len(feeds)))
+		}
+
+		time.Sleep(channelCheck)
+	}
+}
+
+// refreshFeeds fetches the metadata of the feeds. Errors are logged, so that a
+// failing channel refresh does not stop the playlists and the other way
+// around.
+func (f *Fetcher) refreshFeeds(ctx context.Context, feeds []*model.Feed) {
+	channels, playlists := []*model.Feed{}, []*model.Feed{}
+	for _, feed := range feeds {
+		if feed.Source == model.FeedSourcePlaylist {
+			playlists = append(playlists, feed)
 			continue
 		}
-		f.videoPipeline <- video
+		channels = append(channels, feed)
+	}
+	if err := f.refreshChannels(ctx, channels); err != nil {
+		metrics.FetchErrors.WithLabelValues("channels").Inc()
+		f.logger.Error("failed to refresh channels", err)
 	}
+	if err := f.refreshPlaylists(ctx, playlists); err != nil {
+		metrics.FetchErrors.WithLabelValues("playlists").Inc()
+		f.logger.Error("failed to refresh playlists", err)
+	}
+}
 
-	f.logger.Info("fetched historical video page", slog.String("channelid", string(channelID)), slog.String("pagetoken", pageToken), slog.Int("count", len(ytIDs)))
-	return pageToken
+func (f *Fetcher) refreshChannels(ctx context.Context, feeds []*model.Feed) error {
+	for start := 0; start < len(feeds); start += channelBatchSize {
+		end := start + channelBatchSize
+		if end > len(feeds) {
+			end = len(feeds)
+		}
+		batch := feeds[start:end]
+
+		ids := make([]model.YoutubeChannelID, len(batch))
+		for i, feed := range batch {
+			ids[i] = feed.YoutubeChannelID
+		}
+		_, span := tracer.Start(ctx, "fetch.channel_batch", trace.WithAttributes(attribute.Int("yogai.batch_size", len(ids))))
+		mds, err := f.channelReader.FetchChannels(ids)
+		tracing.End(span, err)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		for _, feed := range batch {
+			md, ok := mds[feed.YoutubeChannelID]
+			if !ok {
+				// try again at the next refresh instead of every check
+				f.logger.Warn("channel not found on youtube", slog.String("channelid", string(feed.YoutubeChannelID)))
+			} else {
+				feed.Title = md.Title
+				feed.YoutubeHandle = md.Handle
+				feed.YoutubeDescription = md.Description
+				feed.YoutubeThumbnails = md.Thumbnails
+				feed.YoutubeSubscriberCount = md.SubscriberCount
+				feed.YoutubeVideoCount = md.VideoCount
+				feed.YoutubeCountry = md.Country
+				feed.YoutubeDefaultLanguage = md.DefaultLanguage
+			}
+			feed.RefreshedAt = &now
+			if err := f.feedRepo.SaveMetadata(feed); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (f *Fetcher) refreshPlaylists(ctx context.Context, feeds []*model.Feed) error {
+	for start := 0; start < len(feeds); start += playlistBatchSize {
+		end := start + playlistBatchSize
+		if end > len(feeds) {
+			end = len(feeds)
+		}
+		batch := feeds[start:end]
+
+		ids := make([]model.YoutubePlaylistID, len(batch))
+		for i, feed := range batch {
+			ids[i] = feed.YoutubePlaylistID
+		}
+		_, span := tracer.Start(ctx, "fetch.playlist_batch", trace.WithAttributes(attribute.Int("yogai.batch_size", len(ids))))
+		mds, err := f.playlistReader.FetchPlaylists(ids)
+		tracing.End(span, err)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		for _, feed := range batch {
+			md, ok := mds[feed.YoutubePlaylistID]
+			if !ok {
+				f.logger.Warn("playlist not found on youtube", slog.String("playlistid", string(feed.YoutubePlaylistID)))
+			} else {
+				feed.Title = md.Title
+				feed.YoutubeDescription = md.Description
+				feed.YoutubeThumbnails = md.Thumbnails
+				feed.YoutubeChannelID = md.ChannelID
+				feed.YoutubeVideoCount = md.ItemCount
+			}
+			feed.RefreshedAt = &now
+			if err := f.feedRepo.SaveMetadata(feed); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// syncPlaylist reads all videos in the playlist. Videos that are not known yet
+// are added, the positions of the others are updated and videos that are no
+// longer in the playlist are unlinked from it.
+func (f *Fetcher) syncPlaylist(ctx context.Context, feed *model.Feed) error {
+	ctx, span := tracer.Start(ctx, "fetch.playlist", trace.WithAttributes(attribute.String("yogai.playlist.id", string(feed.YoutubePlaylistID))))
+	var err error
+	defer func() { tracing.End(span, err) }()
+
+	seen := map[uuid.UUID]bool{}
+	token := ""
+	for {
+		var entries []PlaylistEntry
+		entries, token, err = f.playlistReader.PlaylistItems(feed.YoutubePlaylistID, token)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			item := &model.PlaylistItem{FeedID: feed.ID, Position: entry.Position}
+			var video *model.Video
+			video, err = f.videoRepo.FindByYoutubeID(entry.YoutubeID)
+			switch {
+			case errors.Is(err, storage.ErrNotFound):
+				video = &model.Video{
+					ID:               uuid.New(),
+					Status:           model.StatusNew,
+					YoutubeID:        entry.YoutubeID,
+					YoutubeChannelID: entry.YoutubeChannelID,
+				}
+				item.VideoID = video.ID
+				if f.addVideo(ctx, video, model.PriorityNormal, "playlist fetch", item) {
+					seen[video.ID] = true
+				}
+				err = nil
+				continue
+			case err != nil:
+				return err
+			}
+			item.VideoID = video.ID
+			if err = f.playlistRepo.Save(item); err != nil {
+				return err
+			}
+			seen[video.ID] = true
+		}
+		if token == "" {
+			break
+		}
+	}
+
+	var items []*model.PlaylistItem
+	if items, err = f.playlistRepo.FindByFeed(feed.ID); err != nil {
+		return err
+	}
+	for _, item := range items {
+		if seen[item.VideoID] {
+			continue
+		}
+		if err = f.playlistRepo.Delete(item); err != nil {
+			return err
+		}
+	}
+	f.logger.Info("synced playlist", slog.String("playlistid", string(feed.YoutubePlaylistID)), slog.Int("count", len(seen)))
+
+	return nil
 }
 
+// FindUnprocessed puts all videos that are not ready in the queue that
+// matches their status
 func (f *Fetcher) FindUnprocessed() {
 	f.logger.Info("looking for unprocessed videos")
 	videos, err := f.videoRepo.FindByStatus(model.StatusNew, model.StatusFetched)
@@ -135,7 +523,30 @@ func (f *Fetcher) FindUnprocessed() {
 	}
 	f.logger.Info("found unprocessed videos", slog.Int("count", len(videos)))
 	for _, video := range videos {
-		f.videoPipeline <- video
+		queue := model.QueueMetadata
+		if video.Status == model.StatusFetched {
+			queue = model.QueueProcess
+		}
+		if err := f.queue.Enqueue(queue, video.ID, model.PriorityNormal); err != nil {
+			f.logger.Error("failed to enqueue video", err)
+		}
+	}
+}
+
+// FindOutdated sends all ready videos with a summary that was made with an
+// older prompt version to the processors again
+func (f *Fetcher) FindOutdated(summaryVersion string) {
+	f.logger.Info("looking for outdated videos", slog.String("summaryversion", summaryVersion))
+	videos, err := f.videoRepo.FindOutdated(summaryVersion)
+	if err != nil {
+		f.logger.Error("failed to fetch outdated videos", err)
+		return
+	}
+	f.logger.Info("found outdated videos", slog.Int("count", len(videos)))
+	for _, video := range videos {
+		if err := f.queue.Enqueue(model.QueueProcess, video.ID, model.PriorityLow); err != nil {
+			f.logger.Error("failed to enqueue video", err)
+		}
 	}
 }
 
@@ -143,93 +554,460 @@ func (f *Fetcher) ReadFeeds() {
 	f.logger.Info("started feed reader")
 	ticker := time.NewTicker(f.interval)
 	for range ticker.C {
-		entries, err := f.feedReader.Unread()
-		if err != nil {
-			f.logger.Error("failed to fetch unread entries", err)
-			continue
-		}
-		f.logger.Info("fetched unread entries", slog.Int("count", len(entries)))
-		if len(entries) == 0 {
+		f.readFeed()
+	}
+}
+
+func (f *Fetcher) readFeed() {
+	metrics.FetchIterations.WithLabelValues("feed_reader").Inc()
+	ctx, span := tracer.Start(context.Background(), "fetch.read_feed")
+	defer span.End()
+
+	entries, err := f.feedReader.Unread()
+	if err != nil {
+		metrics.FetchErrors.WithLabelValues("feed_reader").Inc()
+		f.logger.Error("failed to fetch unread entries", err)
+		span.RecordError(err)
+		return
+	}
+	f.logger.Info("fetched unread entries", slog.Int("count", len(entries)))
+	span.SetAttributes(attribute.Int("yogai.entries", len(entries)))
+
+	feeds := map[model.YoutubeChannelID]bool{}
+	for _, entry := range entries {
+		if err := f.ensureFeed(model.YoutubeChannelID(entry.YoutubeChannelID), feeds); err != nil {
+			metrics.FetchErrors.WithLabelValues("feed_reader").Inc()
+			f.logger.Error("failed to add feed", err, slog.String("channelid", entry.YoutubeChannelID))
 			continue
 		}
-
-		for _, entry := range entries {
+		// the video can already be known from the historical fetch, a
+		// playlist or the api
+		_, err := f.videoRepo.FindByYoutubeID(model.YoutubeVideoID(entry.YoutubeID))
+		switch {
+		case errors.Is(err, storage.ErrNotFound):
 			video := &model.Video{
 				ID:               uuid.New(),
 				Status:           model.StatusNew,
 				YoutubeID:        model.YoutubeVideoID(entry.YoutubeID),
 				YoutubeChannelID: model.YoutubeChannelID(entry.YoutubeChannelID),
 			}
-			if err := f.videoRepo.Save(video); err != nil {
-				f.logger.Error("failed to save video", err)
-				continue
-			}
-			f.videoPipeline <- video
-			if err := f.feedReader.MarkRead(entry.EntryID); err != nil {
-				f.logger.Error("failed to mark entry as read", err)
+			if !f.addVideo(ctx, video, model.PriorityHigh, "feed reader") {
 				continue
 			}
+		case err != nil:
+			metrics.FetchErrors.WithLabelValues("feed_reader").Inc()
+			f.logger.Error("failed to find video", err, slog.String("video", entry.YoutubeID))
+			continue
+		}
+		if err := f.feedReader.MarkRead(entry.EntryID); err != nil {
+			metrics.FetchErrors.WithLabelValues("feed_reader").Inc()
+			f.logger.Error("failed to mark entry as read", err)
+			continue
+		}
+	}
+}
+
+// ensureFeed adds a full feed for a channel that was subscribed to in the feed
+// reader, but is not known yet or only has an ad hoc feed. Checked channels
+// are kept in seen.
+func (f *Fetcher) ensureFeed(channelID model.YoutubeChannelID, seen map[model.YoutubeChannelID]bool) error {
+	if seen[channelID] {
+		return nil
+	}
+	feed, err := f.feedRepo.FindByYoutubeChannelID(channelID)
+	switch {
+	case err == nil && feed.Status != model.FeedStatusAdHoc:
+	case err == nil || errors.Is(err, storage.ErrNotFound):
+		if err := f.AddFeed(&model.Feed{Source: model.FeedSourceChannel, YoutubeChannelID: channelID}); err != nil {
+			return err
+		}
+		f.logger.Info("added feed from feed reader", slog.String("channelid", string(channelID)))
+	default:
+		return err
+	}
+	seen[channelID] = true
+
+	return nil
+}
+
+// addVideo saves a new video and queues it for metadata fetching. The
+// playlist items are saved before the video is queued, so that the metadata
+// fetch can find the playlists it is in.
+func (f *Fetcher) addVideo(ctx context.Context, video *model.Video, priority int, actor string, items ...*model.PlaylistItem) bool {
+	_, span := tracer.Start(ctx, "fetch.save", tracing.Video(video.ID))
+	defer span.End()
+
+	if err := f.videoRepo.Save(video); err != nil {
+		f.logger.Error("failed to save video", err)
+		span.RecordError(err)
+		return false
+	}
+	f.addEvent(model.NewStatusEvent(video, "", actor))
+	for _, item := range items {
+		if err := f.playlistRepo.Save(item); err != nil {
+			f.logger.Error("failed to save playlist item", err)
+			span.RecordError(err)
+			return false
 		}
 	}
+	if err := f.queue.Enqueue(model.QueueMetadata, video.ID, priority); err != nil {
+		f.logger.Error("failed to enqueue video", err)
+		span.RecordError(err)
+		return false
+	}
+
+	return true
 }
 
 func (f *Fetcher) MetadataFetcher() {
 	f.logger.Info("started metadata fetch")
 
-	buffer := []*model.Video{}
-	timeout := time.NewTimer(10 * time.Second)
-	fetch := make(chan []*model.Video)
+	for {
+		metrics.FetchIterations.WithLabelValues("metadata").Inc()
+		jobs, err := f.queue.Lease(model.QueueMetadata, metadataBatchSize, metadataVisibility)
+		if err != nil {
+			metrics.FetchErrors.WithLabelValues("metadata").Inc()
+			f.logger.Error("failed to lease metadata jobs", err)
+		}
+		if len(jobs) == 0 {
+			time.Sleep(f.pollInterval)
+			continue
+		}
+
+		f.fetchMetadata(jobs)
+	}
+}
+
+func (f *Fetcher) fetchMetadata(jobs []*model.Job) {
+	f.logger.Info("fetching metadata", slog.Int("count", len(jobs)))
+	ctx, span := tracer.Start(context.Background(), "fetch.metadata_batch", trace.WithAttributes(attribute.Int("yogai.batch_size", len(jobs))))
+	defer span.End()
+
+	videos := make(map[*model.Job]*model.Video, len(jobs))
+	ids := make([]model.YoutubeVideoID, 0, len(jobs))
+	for _, job := range jobs {
+		video, err := f.videoRepo.FindByID(job.SubjectID)
+		if err != nil {
+			f.logger.Error("failed to find video", err)
+			f.nack(job, err)
+			continue
+		}
+		videos[job] = video
+		ids = append(ids, video.YoutubeID)
+	}
+	if len(ids) == 0 {
+		return
+	}
+
+	metrics.MetadataBatchSize.Observe(float64(len(ids)))
+	mds, err := f.metadataFetcher.FetchMetadata(ids)
+	if err != nil {
+		metrics.FetchErrors.WithLabelValues("metadata").Inc()
+		f.logger.Error("failed to fetch metadata", err)
+		span.RecordError(err)
+		for job := range videos {
+			f.nack(job, err)
+		}
+		return
+	}
+
+	feeds := map[string]*model.Feed{}
+	for job, video := range videos {
+		now := time.Now()
+		video.AvailabilityCheckedAt = &now
+		md, ok := mds[video.YoutubeID]
+		if !ok {
+			md.UnavailableReason = model.UnavailableMissing
+		}
+		if md.UnavailableReason != "" {
+			f.markUnavailable(ctx, job, video, md.UnavailableReason)
+			continue
+		}
+
+		video.UnavailableReason = ""
+		video.YoutubeTitle = md.Title
+		video.YoutubeDescription = md.Description
+		video.YoutubeDuration = md.Duration
+		video.YoutubePublishedAt = md.PublishedAt
+		video.YoutubeTags = md.Tags
+		video.YoutubeCategoryID = md.CategoryID
+		video.YoutubeDefaultAudioLanguage = md.DefaultAudioLanguage
+		video.YoutubeThumbnails = md.Thumbnails
+		video.YoutubeCaption = md.Caption
+		video.YoutubeDefinition = md.Definition
+		video.YoutubeViewCount = md.Statistics.ViewCount
+		video.YoutubeLikeCount = md.Statistics.LikeCount
+		video.YoutubeCommentCount = md.Statistics.CommentCount
+		video.StatisticsRefreshedAt = &now
+
+		videoFeeds, err := f.feedsFor(video, feeds)
+		if err != nil {
+			f.logger.Error("failed to find feed", err)
+			f.nack(job, err)
+			continue
+		}
+
+		previous := video.Status
+		setStatus(video, md, videoFeeds)
 
-	go func() {
-		for videos := range fetch {
-			f.logger.Info("fetching metadata", slog.Int("count", len(videos)))
-			ids := make([]model.YoutubeVideoID, 0, len(videos))
-			for _, video := range videos {
-				ids = append(ids, video.YoutubeID)
+		_, saveSpan := tracer.Start(ctx, "fetch.save", tracing.Video(video.ID), trace.WithAttributes(attribute.String("yogai.video_type", string(video.Type))))
+		if err := f.videoRepo.Save(video); err != nil {
+			f.logger.Error("failed to save video", err)
+			f.nack(job, err)
+			tracing.End(saveSpan, err)
+			continue
+		}
+		if previous != video.Status {
+			f.addEvent(model.NewStatusEvent(video, previous, "metadata fetcher"))
+		}
+		switch video.Status {
+		case model.StatusNew:
+			delay := time.Until(*md.AvailableAt) + airedMargin
+			f.logger.Info("waiting for video to air", slog.String("video", string(video.YoutubeID)), slog.Duration("delay", delay))
+			if err := f.queue.Nack(job, nil, delay); err != nil {
+				f.logger.Error("failed to nack job", err)
 			}
-			mds, err := f.metadataFetcher.FetchMetadata(ids)
-			if err != nil {
-				f.logger.Error("failed to fetch metadata", err)
+		case model.StatusFetched:
+			if err := f.queue.Enqueue(model.QueueProcess, video.ID, job.Priority); err != nil {
+				f.logger.Error("failed to enqueue video", err)
+				f.nack(job, err)
+				tracing.End(saveSpan, err)
 				continue
 			}
-			for _, video := range videos {
-				md := mds[video.YoutubeID]
-				video.YoutubeTitle = md.Title
-				video.YoutubeDescription = md.Description
-				video.YoutubeDuration = md.Duration
-				video.YoutubePublishedAt = md.PublishedAt
-				video.Status = model.StatusFetched
+			f.ack(job)
+		default:
+			f.logger.Info("skipped video", slog.String("video", string(video.YoutubeID)), slog.String("reason", video.SkipReason))
+			f.ack(job)
+		}
+		saveSpan.End()
+	}
+	f.logger.Info("fetched metadata", slog.Int("count", len(videos)))
+}
 
-				if err := f.videoRepo.Save(video); err != nil {
-					f.logger.Error("failed to save video", err)
-					continue
-				}
+// setStatus sets the type and the status of the video from its metadata.
+// Premieres and streams that have not ended yet stay new, so that they are
+// fetched again when they have aired. Only then are the rules of the feeds
+// checked, the type can still change.
+func setStatus(video *model.Video, md Metadata, feeds []*model.Feed) {
+	video.Type = md.Type
+	video.Premiere = video.Premiere || md.Premiere
+	if video.Type == model.VideoTypeLive && video.Premiere && md.AvailableAt == nil {
+		// an aired premiere looks like an ended stream, but it is a regular
+		// upload
+		video.Type = model.VideoTypeRegular
+	}
+	video.SkipReason = ""
+
+	switch {
+	case md.AvailableAt != nil:
+		video.Status = model.StatusNew
+	default:
+		video.SkipReason = skipReason(video, feeds)
+		video.Status = model.StatusFetched
+		if video.SkipReason != "" {
+			video.Status = model.StatusSkipped
+		}
+	}
+}
+
+// feedsFor returns the channel feed of the video, if there is one, and the
+// playlist feeds that contain it. Feeds are kept in cache by channel id and by
+// feed id, so that a batch looks them up only once.
+func (f *Fetcher) feedsFor(video *model.Video, cache map[string]*model.Feed) ([]*model.Feed, error) {
+	feeds := []*model.Feed{}
+	key := "channel:" + string(video.YoutubeChannelID)
+	feed, ok := cache[key]
+	if !ok {
+		var err error
+		feed, err = f.feedRepo.FindByYoutubeChannelID(video.YoutubeChannelID)
+		if err != nil && !errors.Is(err, storage.ErrNotFound) {
+			return nil, err
+		}
+		cache[key] = feed
+	}
+	if feed != nil {
+		feeds = append(feeds, feed)
+	}
 
-				f.out <- video
+	items, err := f.playlistRepo.FindByVideo(video.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range items {
+		key := item.FeedID.String()
+		feed, ok := cache[key]
+		if !ok {
+			if feed, err = f.feedRepo.FindByID(item.FeedID); err != nil {
+				return nil, err
 			}
-			f.logger.Info("fetched metadata", slog.Int("count", len(videos)))
+			cache[key] = feed
+		}
+		feeds = append(feeds, feed)
+	}
+
+	return feeds, nil
+}
+
+// skipReason returns an empty string when at least one of the feeds wants the
+// video, or when the video was requested, otherwise the reason of the first
+// one
+func skipReason(video *model.Video, feeds []*model.Feed) string {
+	if video.Requested {
+		return ""
+	}
+	if len(feeds) == 0 {
+		return "video is not in any feed"
+	}
+	reason := ""
+	for _, feed := range feeds {
+		r := feed.SkipReason(video)
+		if r == "" {
+			return ""
 		}
-	}()
+		if reason == "" {
+			reason = r
+		}
+	}
+
+	return reason
+}
 
+// markUnavailable keeps the video out of processing until a recheck finds
+// it again
+func (f *Fetcher) markUnavailable(ctx context.Context, job *model.Job, video *model.Video, reason string) {
+	_, span := tracer.Start(ctx, "fetch.unavailable", tracing.Video(video.ID), trace.WithAttributes(attribute.String("yogai.reason", reason)))
+	defer span.End()
+
+	f.logger.Info("video is unavailable", slog.String("video", string(video.YoutubeID)), slog.String("reason", reason))
+	previous := video.Status
+	video.Status = model.StatusUnavailable
+	video.UnavailableReason = reason
+	if err := f.videoRepo.Save(video); err != nil {
+		f.logger.Error("failed to save video", err)
+		f.nack(job, err)
+		span.RecordError(err)
+		return
+	}
+	if previous != video.Status {
+		f.addEvent(model.NewStatusEvent(video, previous, "metadata fetcher"))
+	}
+	f.ack(job)
+}
+
+// RecheckUnavailable puts unavailable videos back in the metadata queue when
+// they were last checked longer than the recheck interval ago, so that they
+// are processed when they become available again
+func (f *Fetcher) RecheckUnavailable() {
+	f.logger.Info("started unavailable recheck")
 	for {
-		select {
-		case video := <-f.needsMetadata:
-			timeout.Reset(10 * time.Second)
-			buffer = append(buffer, video)
-			if len(buffer) >= 50 {
-				batch := make([]*model.Video, len(buffer))
-				copy(batch, buffer)
-				fetch <- batch
-				buffer = []*model.Video{}
-			}
-		case <-timeout.C:
-			if len(buffer) == 0 {
+		metrics.FetchIterations.WithLabelValues("unavailable").Inc()
+		videos, err := f.videoRepo.FindByStatus(model.StatusUnavailable)
+		if err != nil {
+			metrics.FetchErrors.WithLabelValues("unavailable").Inc()
+			f.logger.Error("failed to find unavailable videos", err)
+		}
+		count := 0
+		for _, video := range videos {
+			if video.AvailabilityCheckedAt != nil && time.Since(*video.AvailabilityCheckedAt) < f.recheck {
+				continue
+			}
+			if err := f.queue.Enqueue(model.QueueMetadata, video.ID, model.PriorityLow); err != nil {
+				metrics.FetchErrors.WithLabelValues("unavailable").Inc()
+				f.logger.Error("failed to enqueue video", err)
 				continue
 			}
-			batch := make([]*model.Video, len(buffer))
-			copy(batch, buffer)
-			fetch <- batch
-			buffer = []*model.Video{}
+			count++
+		}
+		if count > 0 {
+			f.logger.Info("queued unavailable videos for recheck", slog.Int("count", count))
+		}
+
+		time.Sleep(recheckCheck)
+	}
+}
+
+// RefreshStatistics fetches the view, like and comment counts of videos
+// again when they are older than the refresh interval
+func (f *Fetcher) RefreshStatistics() {
+	f.logger.Info("started statistics refresh")
+	for {
+		metrics.FetchIterations.WithLabelValues("statistics").Inc()
+		videos, err := f.videoRepo.FindStatisticsBefore(time.Now().Add(-f.statsRefresh), statisticsLimit)
+		if err != nil {
+			metrics.FetchErrors.WithLabelValues("statistics").Inc()
+			f.logger.Error("failed to find videos to refresh", err)
+		}
+		failed := err != nil
+		for start := 0; start < len(videos); start += metadataBatchSize {
+			end := start + metadataBatchSize
+			if end > len(videos) {
+				end = len(videos)
+			}
+			if err := f.refreshStatistics(videos[start:end]); err != nil {
+				metrics.FetchErrors.WithLabelValues("statistics").Inc()
+				f.logger.Error("failed to refresh statistics", err)
+				failed = true
+				break
+			}
+		}
+		if len(videos) > 0 {
+			f.logger.Info("refreshed statistics", slog.Int("count", len(videos)))
+		}
+		// keep going while there is a backlog
+		if failed || len(videos) < statisticsLimit {
+			time.Sleep(statisticsCheck)
+		}
+	}
+}
+
+func (f *Fetcher) refreshStatistics(videos []*model.Video) error {
+	_, span := tracer.Start(context.Background(), "fetch.statistics_batch", trace.WithAttributes(attribute.Int("yogai.batch_size", len(videos))))
+	ids := make([]model.YoutubeVideoID, len(videos))
+	for i, video := range videos {
+		ids[i] = video.YoutubeID
+	}
+	stats, err := f.metadataFetcher.FetchStatistics(ids)
+	if err != nil {
+		tracing.End(span, err)
+		return err
+	}
+
+	now := time.Now()
+	for _, video := range videos {
+		// videos that are gone keep their last counts
+		if s, ok := stats[video.YoutubeID]; ok {
+			video.YoutubeViewCount = s.ViewCount
+			video.YoutubeLikeCount = s.LikeCount
+			video.YoutubeCommentCount = s.CommentCount
+		}
+		video.StatisticsRefreshedAt = &now
+		if err := f.videoRepo.SaveStatistics(video); err != nil {
+			tracing.End(span, err)
+			return err
 		}
 	}
+	span.End()
+
+	return nil
+}
+
+func (f *Fetcher) addEvent(event *model.VideoEvent) {
+	if err := f.eventRepo.Add(event); err != nil {
+		f.logger.Error("failed to add video event", err)
+	}
+}
+
+func (f *Fetcher) ack(job *model.Job) {
+	if err := f.queue.Ack(job); err != nil {
+		f.logger.Error("failed to ack job", err)
+	}
+}
+
+func (f *Fetcher) nack(job *model.Job, jobErr error) {
+	if job.Exhausted() {
+		f.logger.Warn("giving up on job", slog.String("queue", string(job.Queue)), slog.String("subject", job.SubjectID.String()), slog.Int("attempts", job.Attempts))
+	}
+	if err := f.queue.Nack(job, jobErr, job.Backoff()); err != nil {
+		f.logger.Error("failed to nack job", err)
+	}
 }
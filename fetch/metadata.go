@@ -1,14 +1,61 @@
 package fetch
 
-import "go-mod.ewintr.nl/yogai/model"
+import (
+	"time"
+
+	"go-mod.ewintr.nl/yogai/model"
+)
 
 type Metadata struct {
+	ChannelID            model.YoutubeChannelID
+	Title                string
+	Description          string
+	Duration             string
+	PublishedAt          string
+	Tags                 []string
+	CategoryID           string
+	DefaultAudioLanguage string
+	Thumbnails           model.Thumbnails
+	Caption              bool
+	Definition           string
+	Statistics           Statistics
+	// UnavailableReason is set when the video can not be watched
+	UnavailableReason string
+	Type              model.VideoType
+	// Premiere is set for premieres that have not aired yet
+	Premiere bool
+	// AvailableAt is set for premieres and streams that have not ended yet,
+	// the metadata should be fetched again after it
+	AvailableAt *time.Time
+}
+
+type Statistics struct {
+	ViewCount    int64
+	LikeCount    int64
+	CommentCount int64
+}
+
+type ChannelMetadata struct {
+	Title           string
+	Handle          string
+	Description     string
+	Thumbnails      model.Thumbnails
+	SubscriberCount int64
+	VideoCount      int64
+	Country         string
+	DefaultLanguage string
+}
+
+type PlaylistMetadata struct {
 	Title       string
 	Description string
-	Duration    string
-	PublishedAt string
+	Thumbnails  model.Thumbnails
+	// ChannelID is the channel that owns the playlist
+	ChannelID model.YoutubeChannelID
+	ItemCount int64
 }
 
 type MetadataFetcher interface {
 	FetchMetadata([]model.YoutubeVideoID) (map[model.YoutubeVideoID]Metadata, error)
+	FetchStatistics([]model.YoutubeVideoID) (map[model.YoutubeVideoID]Statistics, error)
 }
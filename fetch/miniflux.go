@@ -1,8 +1,13 @@
 package fetch
 
 import (
+	"context"
+	"fmt"
+	"net/http"
 	"strings"
 
+	"go-mod.ewintr.nl/yogai/model"
+	"go-mod.ewintr.nl/yogai/youtubeurl"
 	"miniflux.app/client"
 )
 
@@ -14,40 +19,197 @@ type Entry struct {
 	Description     string
 }
 
+// minifluxPageSize is the number of entries that is requested at once
+const minifluxPageSize = 100
+
+// MinifluxInfo configures the client. With FeedIDs, only those feeds are
+// read, otherwise with a CategoryID only the feeds in that category, and
+// without both all feeds of the user.
 type MinifluxInfo struct {
-	Endpoint string
-	ApiKey   string
+	Endpoint   string
+	ApiKey     string
+	CategoryID int64
+	FeedIDs    []int64
 }
 
 type Miniflux struct {
-	client *client.Client
+	client     *client.Client
+	httpClient *http.Client
+	endpoint   string
+	apiKey     string
+	categoryID int64
+	feedIDs    []int64
 }
 
 func NewMiniflux(mflInfo MinifluxInfo) *Miniflux {
 	return &Miniflux{
-		client: client.New(mflInfo.Endpoint, mflInfo.ApiKey),
+		client:     client.New(mflInfo.Endpoint, mflInfo.ApiKey),
+		httpClient: http.DefaultClient,
+		endpoint:   strings.TrimSuffix(strings.TrimSuffix(mflInfo.Endpoint, "/"), "/v1"),
+		apiKey:     mflInfo.ApiKey,
+		categoryID: mflInfo.CategoryID,
+		feedIDs:    mflInfo.FeedIDs,
+	}
+}
+
+// Ping checks whether the api can be reached with the configured key. The
+// client does not accept a context, so the request is made directly.
+func (m *Miniflux) Ping(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, m.endpoint+"/v1/me", nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Auth-Token", m.apiKey)
+	resp, err := m.httpClient.Do(req)
+	if err != nil {
+		return err
 	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("miniflux responded with status %d", resp.StatusCode)
+	}
+
+	return nil
 }
 
+// Unread returns the unread entries of the YouTube channel feeds among the
+// configured feeds, reading all pages. Other feeds are not read at all, so
+// that their entries are left alone. Entries of channel feeds that do not
+// link to a video are marked as read, otherwise they would be read again on
+// every call.
 func (m *Miniflux) Unread() ([]FeedEntry, error) {
-	result, err := m.client.Entries(&client.Filter{Status: "unread"})
+	feeds, err := m.feeds()
 	if err != nil {
 		return nil, err
 	}
 
-	entries := make([]FeedEntry, 0, len(result.Entries))
-	for _, entry := range result.Entries {
-		entries = append(entries, FeedEntry{
-			EntryID:          entry.ID,
-			FeedID:           entry.FeedID,
-			YoutubeChannelID: strings.TrimPrefix(entry.Feed.FeedURL, "https://www.youtube.com/feeds/videos.xml?channel_id="),
-			YoutubeID:        strings.TrimPrefix(entry.URL, "https://www.youtube.com/watch?v="),
-		})
+	entries, noVideo := []FeedEntry{}, []int64{}
+	for _, feed := range feeds {
+		// playlists are read through the youtube api
+		yt, err := youtubeurl.Feed(feed.FeedURL)
+		if err != nil || yt.Source != model.FeedSourceChannel {
+			continue
+		}
+
+		// oldest first, so that new entries end up on the last page and do
+		// not shift the offsets
+		filter := client.Filter{
+			FeedID:    feed.ID,
+			Status:    "unread",
+			Order:     "id",
+			Direction: "asc",
+			Limit:     minifluxPageSize,
+		}
+		for {
+			result, err := m.client.Entries(&filter)
+			if err != nil {
+				return nil, err
+			}
+			for _, entry := range result.Entries {
+				ytID, err := youtubeurl.Video(entry.URL)
+				if err != nil {
+					noVideo = append(noVideo, entry.ID)
+					continue
+				}
+				entries = append(entries, FeedEntry{
+					EntryID:          entry.ID,
+					FeedID:           entry.FeedID,
+					YoutubeChannelID: string(yt.ChannelID),
+					YoutubeID:        string(ytID),
+				})
+			}
+			filter.Offset += len(result.Entries)
+			if len(result.Entries) == 0 || filter.Offset >= result.Total {
+				break
+			}
+		}
+	}
+	if len(noVideo) > 0 {
+		if err := m.client.UpdateEntries(noVideo, "read"); err != nil {
+			return nil, err
+		}
 	}
 
 	return entries, nil
 }
 
+// feeds returns the configured feeds
+func (m *Miniflux) feeds() (client.Feeds, error) {
+	switch {
+	case len(m.feedIDs) > 0:
+		feeds := client.Feeds{}
+		for _, id := range m.feedIDs {
+			feed, err := m.client.Feed(id)
+			if err != nil {
+				return nil, err
+			}
+			feeds = append(feeds, feed)
+		}
+		return feeds, nil
+	case m.categoryID > 0:
+		return m.client.CategoryFeeds(m.categoryID)
+	default:
+		return m.client.Feeds()
+	}
+}
+
+// Subscriptions returns the YouTube feeds among the configured feeds
+func (m *Miniflux) Subscriptions() ([]Subscription, error) {
+	feeds, err := m.feeds()
+	if err != nil {
+		return nil, err
+	}
+
+	subs := make([]Subscription, 0, len(feeds))
+	for _, feed := range feeds {
+		yt, err := youtubeurl.Feed(feed.FeedURL)
+		if err != nil {
+			continue
+		}
+		subs = append(subs, Subscription{
+			FeedID:            feed.ID,
+			Source:            yt.Source,
+			YoutubeChannelID:  yt.ChannelID,
+			YoutubePlaylistID: yt.PlaylistID,
+		})
+	}
+
+	return subs, nil
+}
+
+// Subscribe adds the RSS feed of the channel to the configured category, or to
+// the first category of the user. Playlists can not be subscribed to, their
+// entries would never be read. When the client is limited to feed ids, new
+// feeds would not be read either, so that is an error too.
+func (m *Miniflux) Subscribe(feed *model.Feed) error {
+	if feed.Source != model.FeedSourceChannel {
+		return fmt.Errorf("can not subscribe to %s %s, only channels are read from miniflux", feed.Source, feed.YoutubePlaylistID)
+	}
+	feedURL := youtubeurl.ChannelFeed(feed.YoutubeChannelID)
+	if len(m.feedIDs) > 0 {
+		return fmt.Errorf("can not subscribe to %s, miniflux is limited to feed ids", feedURL)
+	}
+
+	categoryID := m.categoryID
+	if categoryID == 0 {
+		categories, err := m.client.Categories()
+		if err != nil {
+			return err
+		}
+		if len(categories) == 0 {
+			return fmt.Errorf("can not subscribe to %s, miniflux has no categories", feedURL)
+		}
+		categoryID = categories[0].ID
+	}
+
+	_, err := m.client.CreateFeed(&client.FeedCreationRequest{
+		FeedURL:    feedURL,
+		CategoryID: categoryID,
+	})
+
+	return err
+}
+
 func (m *Miniflux) MarkRead(entryID int64) error {
 	if err := m.client.UpdateEntries([]int64{entryID}, "read"); err != nil {
 		return err
@@ -0,0 +1,130 @@
+package fetch
+
+import (
+	"fmt"
+	"time"
+
+	"go-mod.ewintr.nl/yogai/metrics"
+	"go-mod.ewintr.nl/yogai/model"
+	"go-mod.ewintr.nl/yogai/storage"
+	"golang.org/x/exp/slog"
+)
+
+// SyncReport lists the differences between the feeds and the subscriptions
+// in the feed reader that were found during a sync
+type SyncReport struct {
+	// MissingFeeds are followed in the feed reader, but have no feed
+	MissingFeeds []string
+	// MissingSubscriptions are feeds that are not followed in the feed reader
+	MissingSubscriptions []string
+	// Errors are the differences that could not be fixed
+	Errors []string
+}
+
+// Sync keeps the feeds and the subscriptions in the feed reader the same.
+// Subscriptions without a feed are added as feed, channel feeds without a
+// subscription are subscribed to. Playlists are read through the YouTube api,
+// so they are not subscribed to, and ad hoc feeds are not subscriptions.
+// Without fix, the differences are only reported.
+type Sync struct {
+	feedRepo storage.FeedRelRepository
+	subs     SubscriptionManager
+	fetcher  *Fetcher
+	interval time.Duration
+	fix      bool
+	logger   *slog.Logger
+}
+
+func NewSync(feedRepo storage.FeedRelRepository, subs SubscriptionManager, fetcher *Fetcher, interval time.Duration, fix bool, logger *slog.Logger) *Sync {
+	return &Sync{
+		feedRepo: feedRepo,
+		subs:     subs,
+		fetcher:  fetcher,
+		interval: interval,
+		fix:      fix,
+		logger:   logger,
+	}
+}
+
+func (s *Sync) Run() {
+	s.logger.Info("started subscription sync", slog.Bool("fix", s.fix))
+	for {
+		metrics.FetchIterations.WithLabelValues("sync").Inc()
+		report, err := s.Sync()
+		if err != nil {
+			metrics.FetchErrors.WithLabelValues("sync").Inc()
+			s.logger.Error("failed to sync subscriptions", err)
+		} else {
+			s.logger.Info("synced subscriptions", slog.Any("missing_feeds", report.MissingFeeds), slog.Any("missing_subscriptions", report.MissingSubscriptions), slog.Any("errors", report.Errors))
+		}
+
+		time.Sleep(s.interval)
+	}
+}
+
+func (s *Sync) Sync() (SyncReport, error) {
+	report := SyncReport{
+		MissingFeeds:         []string{},
+		MissingSubscriptions: []string{},
+		Errors:               []string{},
+	}
+	subs, err := s.subs.Subscriptions()
+	if err != nil {
+		return report, err
+	}
+	feeds, err := s.feedRepo.FindAll()
+	if err != nil {
+		return report, err
+	}
+
+	known := map[string]*model.Feed{}
+	for _, feed := range feeds {
+		known[feedKey(feed.Source, string(feed.YoutubeChannelID), string(feed.YoutubePlaylistID))] = feed
+	}
+	subscribed := map[string]bool{}
+	for _, sub := range subs {
+		key := feedKey(sub.Source, string(sub.YoutubeChannelID), string(sub.YoutubePlaylistID))
+		subscribed[key] = true
+		if feed, ok := known[key]; ok && feed.Status != model.FeedStatusAdHoc {
+			continue
+		}
+
+		report.MissingFeeds = append(report.MissingFeeds, key)
+		if !s.fix {
+			continue
+		}
+		if err := s.fetcher.AddFeed(&model.Feed{
+			Source:            sub.Source,
+			YoutubeChannelID:  sub.YoutubeChannelID,
+			YoutubePlaylistID: sub.YoutubePlaylistID,
+		}); err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("could not add feed %s: %v", key, err))
+		}
+	}
+
+	for _, feed := range feeds {
+		key := feedKey(feed.Source, string(feed.YoutubeChannelID), string(feed.YoutubePlaylistID))
+		if subscribed[key] || feed.Status == model.FeedStatusAdHoc || feed.Source == model.FeedSourcePlaylist {
+			continue
+		}
+
+		report.MissingSubscriptions = append(report.MissingSubscriptions, key)
+		if !s.fix {
+			continue
+		}
+		if err := s.subs.Subscribe(feed); err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("could not subscribe to %s: %v", key, err))
+		}
+	}
+
+	return report, nil
+}
+
+// feedKey identifies a channel or playlist, like "channel UC..."
+func feedKey(source model.FeedSource, channelID, playlistID string) string {
+	if source == model.FeedSourcePlaylist {
+		return fmt.Sprintf("%s %s", source, playlistID)
+	}
+
+	return fmt.Sprintf("%s %s", model.FeedSourceChannel, channelID)
+}
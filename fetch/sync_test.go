@@ -0,0 +1,357 @@
+package fetch
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go-mod.ewintr.nl/yogai/model"
+	"go-mod.ewintr.nl/yogai/storage"
+	"go-mod.ewintr.nl/yogai/youtubeurl"
+	"github.com/google/uuid"
+	"golang.org/x/exp/slog"
+	"miniflux.app/client"
+)
+
+const (
+	channelKnown    = model.YoutubeChannelID("UCknownknownknownknown00")
+	channelNew      = model.YoutubeChannelID("UCnewnewnewnewnewnewne00")
+	channelUnsubbed = model.YoutubeChannelID("UCunsubbedunsubbedunsu00")
+	channelAdHoc    = model.YoutubeChannelID("UCadhocadhocadhocadhoc00")
+	channelAdHocSub = model.YoutubeChannelID("UCadhocsubadhocsubadho00")
+	playlistNew     = model.YoutubePlaylistID("PLnewnewnewnewnew")
+	playlistKnown   = model.YoutubePlaylistID("PLknownknownknown")
+)
+
+// fakeMiniflux serves the feed and category routes of the miniflux api
+type fakeMiniflux struct {
+	mu         sync.Mutex
+	feeds      client.Feeds
+	categories client.Categories
+	created    []client.FeedCreationRequest
+}
+
+func newFakeMiniflux(t *testing.T, feeds client.Feeds, categories client.Categories) (*fakeMiniflux, *httptest.Server) {
+	fm := &fakeMiniflux{feeds: feeds, categories: categories}
+	srv := httptest.NewServer(fm)
+	t.Cleanup(srv.Close)
+
+	return fm, srv
+}
+
+func (fm *fakeMiniflux) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+
+	var id int64
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/v1/feeds":
+		fm.write(w, fm.feeds)
+	case r.Method == http.MethodGet && r.URL.Path == "/v1/categories":
+		fm.write(w, fm.categories)
+	case r.Method == http.MethodGet && scan(r.URL.Path, "/v1/categories/%d/feeds", &id):
+		feeds := client.Feeds{}
+		for _, feed := range fm.feeds {
+			if feed.Category != nil && feed.Category.ID == id {
+				feeds = append(feeds, feed)
+			}
+		}
+		fm.write(w, feeds)
+	case r.Method == http.MethodGet && scan(r.URL.Path, "/v1/feeds/%d", &id):
+		for _, feed := range fm.feeds {
+			if feed.ID == id {
+				fm.write(w, feed)
+				return
+			}
+		}
+		http.Error(w, `{"error_message":"not found"}`, http.StatusNotFound)
+	case r.Method == http.MethodPost && r.URL.Path == "/v1/feeds":
+		req := client.FeedCreationRequest{}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, `{"error_message":"invalid body"}`, http.StatusBadRequest)
+			return
+		}
+		fm.created = append(fm.created, req)
+		feed := &client.Feed{ID: int64(100 + len(fm.created)), FeedURL: req.FeedURL, Category: &client.Category{ID: req.CategoryID}}
+		fm.feeds = append(fm.feeds, feed)
+		w.WriteHeader(http.StatusCreated)
+		fm.write(w, map[string]int64{"feed_id": feed.ID})
+	default:
+		http.Error(w, `{"error_message":"unexpected request"}`, http.StatusNotImplemented)
+	}
+}
+
+func (fm *fakeMiniflux) write(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func (fm *fakeMiniflux) createdURLs() []string {
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+
+	urls := []string{}
+	for _, req := range fm.created {
+		urls = append(urls, fmt.Sprintf("%d %s", req.CategoryID, req.FeedURL))
+	}
+
+	return urls
+}
+
+// scan matches path against a format with a single %d
+func scan(path, format string, id *int64) bool {
+	var rest string
+	n, _ := fmt.Sscanf(path+" end", format+" %s", id, &rest)
+
+	return n == 2 && rest == "end"
+}
+
+// memFeedRepo only implements the methods that Sync and AddFeed use
+type memFeedRepo struct {
+	storage.FeedRelRepository
+	feeds []*model.Feed
+}
+
+func (r *memFeedRepo) Save(feed *model.Feed) error {
+	for i, f := range r.feeds {
+		if f.ID == feed.ID {
+			r.feeds[i] = feed
+			return nil
+		}
+	}
+	r.feeds = append(r.feeds, feed)
+
+	return nil
+}
+
+func (r *memFeedRepo) FindByYoutubeChannelID(id model.YoutubeChannelID) (*model.Feed, error) {
+	for _, f := range r.feeds {
+		if f.Source == model.FeedSourceChannel && f.YoutubeChannelID == id {
+			c := *f
+			return &c, nil
+		}
+	}
+
+	return nil, storage.ErrNotFound
+}
+
+func (r *memFeedRepo) FindByYoutubePlaylistID(id model.YoutubePlaylistID) (*model.Feed, error) {
+	for _, f := range r.feeds {
+		if f.Source == model.FeedSourcePlaylist && f.YoutubePlaylistID == id {
+			c := *f
+			return &c, nil
+		}
+	}
+
+	return nil, storage.ErrNotFound
+}
+
+func (r *memFeedRepo) FindAll() ([]*model.Feed, error) {
+	feeds := make([]*model.Feed, 0, len(r.feeds))
+	for _, f := range r.feeds {
+		c := *f
+		feeds = append(feeds, &c)
+	}
+
+	return feeds, nil
+}
+
+// statuses returns the feeds as "status key", sorted
+func (r *memFeedRepo) statuses() []string {
+	s := []string{}
+	for _, f := range r.feeds {
+		s = append(s, fmt.Sprintf("%s %s", f.Status, feedKey(f.Source, string(f.YoutubeChannelID), string(f.YoutubePlaylistID))))
+	}
+	sort.Strings(s)
+
+	return s
+}
+
+// memQueue only records what is enqueued
+type memQueue struct {
+	storage.JobQueue
+	enqueued []uuid.UUID
+}
+
+func (q *memQueue) Enqueue(_ model.Queue, subjectID uuid.UUID, _ int) error {
+	q.enqueued = append(q.enqueued, subjectID)
+	return nil
+}
+
+func TestSync(t *testing.T) {
+	category := &client.Category{ID: 7, Title: "youtube"}
+	subscriptions := client.Feeds{
+		{ID: 1, FeedURL: youtubeurl.ChannelFeed(channelKnown), Category: category},
+		{ID: 2, FeedURL: youtubeurl.ChannelFeed(channelNew), Category: category},
+		{ID: 3, FeedURL: youtubeurl.PlaylistFeed(playlistNew), Category: category},
+		{ID: 4, FeedURL: youtubeurl.ChannelFeed(channelAdHocSub), Category: category},
+		{ID: 5, FeedURL: "https://blog.example.com/feed.xml", Category: &client.Category{ID: 8, Title: "blogs"}},
+	}
+	feeds := func() []*model.Feed {
+		return []*model.Feed{
+			{ID: uuid.New(), Status: model.FeedStatusReady, Source: model.FeedSourceChannel, YoutubeChannelID: channelKnown},
+			{ID: uuid.New(), Status: model.FeedStatusReady, Source: model.FeedSourceChannel, YoutubeChannelID: channelUnsubbed},
+			{ID: uuid.New(), Status: model.FeedStatusReady, Source: model.FeedSourcePlaylist, YoutubePlaylistID: playlistKnown},
+			{ID: uuid.New(), Status: model.FeedStatusAdHoc, Source: model.FeedSourceChannel, YoutubeChannelID: channelAdHoc},
+			{ID: uuid.New(), Status: model.FeedStatusAdHoc, Source: model.FeedSourceChannel, YoutubeChannelID: channelAdHocSub},
+		}
+	}
+	missingFeeds := []string{
+		"channel " + string(channelNew),
+		"playlist " + string(playlistNew),
+		"channel " + string(channelAdHocSub),
+	}
+	missingSubs := []string{"channel " + string(channelUnsubbed)}
+
+	for _, tc := range []struct {
+		name        string
+		info        MinifluxInfo
+		fix         bool
+		expErrors   []string
+		expCreated  []string
+		expStatuses []string
+		expEnqueued int
+	}{
+		{
+			name:       "report",
+			expErrors:  []string{},
+			expCreated: []string{},
+			expStatuses: []string{
+				"ad_hoc channel " + string(channelAdHoc),
+				"ad_hoc channel " + string(channelAdHocSub),
+				"ready channel " + string(channelKnown),
+				"ready channel " + string(channelUnsubbed),
+				"ready playlist " + string(playlistKnown),
+			},
+		},
+		{
+			name:       "fix",
+			fix:        true,
+			expErrors:  []string{},
+			expCreated: []string{"7 " + youtubeurl.ChannelFeed(channelUnsubbed)},
+			expStatuses: []string{
+				"ad_hoc channel " + string(channelAdHoc),
+				"new channel " + string(channelAdHocSub),
+				"new channel " + string(channelNew),
+				"new playlist " + string(playlistNew),
+				"ready channel " + string(channelKnown),
+				"ready channel " + string(channelUnsubbed),
+				"ready playlist " + string(playlistKnown),
+			},
+			expEnqueued: 3,
+		},
+		{
+			name:       "fix in category",
+			info:       MinifluxInfo{CategoryID: 7},
+			fix:        true,
+			expErrors:  []string{},
+			expCreated: []string{"7 " + youtubeurl.ChannelFeed(channelUnsubbed)},
+			expStatuses: []string{
+				"ad_hoc channel " + string(channelAdHoc),
+				"new channel " + string(channelAdHocSub),
+				"new channel " + string(channelNew),
+				"new playlist " + string(playlistNew),
+				"ready channel " + string(channelKnown),
+				"ready channel " + string(channelUnsubbed),
+				"ready playlist " + string(playlistKnown),
+			},
+			expEnqueued: 3,
+		},
+		{
+			name:       "fix with only feed ids",
+			info:       MinifluxInfo{FeedIDs: []int64{1, 2, 3, 4, 5}},
+			fix:        true,
+			expErrors:  []string{fmt.Sprintf("could not subscribe to channel %s: can not subscribe to %s, miniflux is limited to feed ids", channelUnsubbed, youtubeurl.ChannelFeed(channelUnsubbed))},
+			expCreated: []string{},
+			expStatuses: []string{
+				"ad_hoc channel " + string(channelAdHoc),
+				"new channel " + string(channelAdHocSub),
+				"new channel " + string(channelNew),
+				"new playlist " + string(playlistNew),
+				"ready channel " + string(channelKnown),
+				"ready channel " + string(channelUnsubbed),
+				"ready playlist " + string(playlistKnown),
+			},
+			expEnqueued: 3,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			fm, srv := newFakeMiniflux(t, subscriptions, client.Categories{category, {ID: 8, Title: "blogs"}})
+			tc.info.Endpoint, tc.info.ApiKey = srv.URL, "key"
+			feedRepo := &memFeedRepo{feeds: feeds()}
+			queue := &memQueue{}
+			logger := slog.New(slog.NewTextHandler(io.Discard))
+			fetcher := NewFetch(feedRepo, nil, nil, nil, queue, nil, nil, nil, 0, 0, 0, 0, nil, logger)
+			sync := NewSync(feedRepo, NewMiniflux(tc.info), fetcher, time.Hour, tc.fix, logger)
+
+			report, err := sync.Sync()
+			if err != nil {
+				t.Fatalf("exp nil, got %v", err)
+			}
+			if !reflect.DeepEqual(missingFeeds, report.MissingFeeds) {
+				t.Errorf("exp missing feeds %v, got %v", missingFeeds, report.MissingFeeds)
+			}
+			if !reflect.DeepEqual(missingSubs, report.MissingSubscriptions) {
+				t.Errorf("exp missing subscriptions %v, got %v", missingSubs, report.MissingSubscriptions)
+			}
+			if !reflect.DeepEqual(tc.expErrors, report.Errors) {
+				t.Errorf("exp errors %v, got %v", tc.expErrors, report.Errors)
+			}
+			if act := fm.createdURLs(); !reflect.DeepEqual(tc.expCreated, act) {
+				t.Errorf("exp created %v, got %v", tc.expCreated, act)
+			}
+			if act := feedRepo.statuses(); !reflect.DeepEqual(tc.expStatuses, act) {
+				t.Errorf("exp feeds %v, got %v", strings.Join(tc.expStatuses, ", "), strings.Join(act, ", "))
+			}
+			if len(queue.enqueued) != tc.expEnqueued {
+				t.Errorf("exp %d enqueued, got %d", tc.expEnqueued, len(queue.enqueued))
+			}
+		})
+	}
+}
+
+func TestSyncFixed(t *testing.T) {
+	// after a fix, a second sync finds no differences
+	category := &client.Category{ID: 7, Title: "youtube"}
+	_, srv := newFakeMiniflux(t, client.Feeds{
+		{ID: 1, FeedURL: youtubeurl.ChannelFeed(channelNew), Category: category},
+	}, client.Categories{category})
+	feedRepo := &memFeedRepo{feeds: []*model.Feed{
+		{ID: uuid.New(), Status: model.FeedStatusReady, Source: model.FeedSourceChannel, YoutubeChannelID: channelUnsubbed},
+		{ID: uuid.New(), Status: model.FeedStatusReady, Source: model.FeedSourcePlaylist, YoutubePlaylistID: playlistKnown},
+	}}
+	logger := slog.New(slog.NewTextHandler(io.Discard))
+	fetcher := NewFetch(feedRepo, nil, nil, nil, &memQueue{}, nil, nil, nil, 0, 0, 0, 0, nil, logger)
+	sync := NewSync(feedRepo, NewMiniflux(MinifluxInfo{Endpoint: srv.URL, ApiKey: "key"}), fetcher, time.Hour, true, logger)
+
+	if _, err := sync.Sync(); err != nil {
+		t.Fatalf("exp nil, got %v", err)
+	}
+	report, err := sync.Sync()
+	if err != nil {
+		t.Fatalf("exp nil, got %v", err)
+	}
+	if len(report.MissingFeeds) != 0 || len(report.MissingSubscriptions) != 0 || len(report.Errors) != 0 {
+		t.Errorf("exp no differences, got %+v", report)
+	}
+}
+
+func TestMinifluxSubscribePlaylist(t *testing.T) {
+	fm, srv := newFakeMiniflux(t, client.Feeds{}, client.Categories{{ID: 7}})
+	mf := NewMiniflux(MinifluxInfo{Endpoint: srv.URL, ApiKey: "key"})
+
+	if err := mf.Subscribe(&model.Feed{Source: model.FeedSourcePlaylist, YoutubePlaylistID: playlistNew}); err == nil {
+		t.Errorf("exp error, got nil")
+	}
+	if act := fm.createdURLs(); len(act) != 0 {
+		t.Errorf("exp no feeds created, got %v", act)
+	}
+}
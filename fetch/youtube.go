@@ -2,17 +2,25 @@ package fetch
 
 import (
 	"strings"
+	"time"
 
+	"go-mod.ewintr.nl/yogai/metrics"
 	"go-mod.ewintr.nl/yogai/model"
 	"google.golang.org/api/youtube/v3"
 )
 
 type Youtube struct {
 	Client *youtube.Service
+	// Region is the ISO 3166-1 code of the country the videos are watched
+	// from. Without it, region restrictions are ignored.
+	Region string
 }
 
-func NewYoutube(client *youtube.Service) *Youtube {
-	return &Youtube{Client: client}
+func NewYoutube(client *youtube.Service, region string) *Youtube {
+	return &Youtube{
+		Client: client,
+		Region: strings.ToUpper(region),
+	}
 }
 
 func (y *Youtube) Search(channelID model.YoutubeChannelID, pageToken string) ([]model.YoutubeVideoID, string, error) {
@@ -27,7 +35,9 @@ func (y *Youtube) Search(channelID model.YoutubeChannelID, pageToken string) ([]
 		call.PageToken(pageToken)
 	}
 
+	start := time.Now()
 	response, err := call.Do()
+	observe("search", start, err)
 	if err != nil {
 		return []model.YoutubeVideoID{}, "", err
 	}
@@ -46,10 +56,13 @@ func (y *Youtube) FetchMetadata(ytIDs []model.YoutubeVideoID) (map[model.Youtube
 		strIDs[i] = string(id)
 	}
 	call := y.Client.Videos.
-		List([]string{"snippet,contentDetails"}).
-		Id(strings.Join(strIDs, ","))
+		List([]string{"snippet,contentDetails,statistics,status,liveStreamingDetails,player"}).
+		Id(strings.Join(strIDs, ",")).
+		MaxHeight(720)
 
+	start := time.Now()
 	response, err := call.Do()
+	observe("videos", start, err)
 	if err != nil {
 		return map[model.YoutubeVideoID]Metadata{}, err
 	}
@@ -60,17 +73,304 @@ func (y *Youtube) FetchMetadata(ytIDs []model.YoutubeVideoID) (map[model.Youtube
 			continue
 		}
 		md := Metadata{
-			Title:       item.Snippet.Title,
-			Description: item.Snippet.Description,
-			PublishedAt: item.Snippet.PublishedAt,
+			ChannelID:            model.YoutubeChannelID(item.Snippet.ChannelId),
+			Title:                item.Snippet.Title,
+			Description:          item.Snippet.Description,
+			PublishedAt:          item.Snippet.PublishedAt,
+			Tags:                 item.Snippet.Tags,
+			CategoryID:           item.Snippet.CategoryId,
+			DefaultAudioLanguage: item.Snippet.DefaultAudioLanguage,
+			Thumbnails:           thumbnails(item.Snippet.Thumbnails),
+			Statistics:           statistics(item.Statistics),
 		}
 
 		if item.ContentDetails != nil {
 			md.Duration = item.ContentDetails.Duration
+			md.Caption = item.ContentDetails.Caption == "true"
+			md.Definition = item.ContentDetails.Definition
 		}
+		md.UnavailableReason = y.unavailable(item)
+		md.Type, md.AvailableAt = classify(item, time.Now())
+		md.Premiere = premiere(item)
 
 		mds[model.YoutubeVideoID(item.Id)] = md
 	}
 
 	return mds, nil
 }
+
+func (y *Youtube) FetchStatistics(ytIDs []model.YoutubeVideoID) (map[model.YoutubeVideoID]Statistics, error) {
+	strIDs := make([]string, len(ytIDs))
+	for i, id := range ytIDs {
+		strIDs[i] = string(id)
+	}
+	call := y.Client.Videos.
+		List([]string{"statistics"}).
+		Id(strings.Join(strIDs, ","))
+
+	start := time.Now()
+	response, err := call.Do()
+	observe("videos_statistics", start, err)
+	if err != nil {
+		return map[model.YoutubeVideoID]Statistics{}, err
+	}
+
+	stats := make(map[model.YoutubeVideoID]Statistics, len(response.Items))
+	for _, item := range response.Items {
+		stats[model.YoutubeVideoID(item.Id)] = statistics(item.Statistics)
+	}
+
+	return stats, nil
+}
+
+const (
+	shortMax         = 3 * time.Minute
+	shortMaxUnknown  = time.Minute
+	liveRecheckDelay = 30 * time.Minute
+)
+
+// classify tells shorts, livestreams and premieres from regular videos.
+// Shorts are vertical and at most three minutes long, or at most a minute when
+// the size of the player is unknown. For premieres and streams that have not
+// ended, it also returns when to look again.
+func classify(item *youtube.Video, now time.Time) (model.VideoType, *time.Time) {
+	if item.Snippet != nil {
+		switch item.Snippet.LiveBroadcastContent {
+		case "upcoming":
+			next := now.Add(liveRecheckDelay)
+			if item.LiveStreamingDetails != nil {
+				if start, err := time.Parse(time.RFC3339, item.LiveStreamingDetails.ScheduledStartTime); err == nil && start.After(now) {
+					next = start
+				}
+			}
+			return model.VideoTypeUpcoming, &next
+		case "live":
+			next := now.Add(liveRecheckDelay)
+			return model.VideoTypeLive, &next
+		}
+	}
+	if item.LiveStreamingDetails != nil && item.LiveStreamingDetails.ActualStartTime != "" {
+		return model.VideoTypeLive, nil
+	}
+
+	if item.ContentDetails == nil {
+		return model.VideoTypeRegular, nil
+	}
+	duration, err := model.ParseDuration(item.ContentDetails.Duration)
+	if err != nil || duration == 0 {
+		return model.VideoTypeRegular, nil
+	}
+	if item.Player != nil && item.Player.EmbedWidth > 0 && item.Player.EmbedHeight > 0 {
+		if item.Player.EmbedHeight > item.Player.EmbedWidth && duration <= shortMax {
+			return model.VideoTypeShort, nil
+		}
+		return model.VideoTypeRegular, nil
+	}
+	if duration <= shortMaxUnknown {
+		return model.VideoTypeShort, nil
+	}
+
+	return model.VideoTypeRegular, nil
+}
+
+// premiere tells an upcoming or running premiere from a scheduled stream. A
+// premiere plays a video that was uploaded before, so it already has a
+// duration, while a stream has none until it ended.
+func premiere(item *youtube.Video) bool {
+	if item.Snippet == nil || item.ContentDetails == nil {
+		return false
+	}
+	switch item.Snippet.LiveBroadcastContent {
+	case "upcoming", "live":
+	default:
+		return false
+	}
+	duration, err := model.ParseDuration(item.ContentDetails.Duration)
+
+	return err == nil && duration > 0
+}
+
+// unavailable returns the reason a video that YouTube knows about can not be
+// watched, or an empty string if it can
+func (y *Youtube) unavailable(item *youtube.Video) string {
+	if item.Status != nil {
+		switch {
+		case item.Status.PrivacyStatus == "private":
+			return model.UnavailablePrivate
+		case item.Status.UploadStatus == "rejected" || item.Status.UploadStatus == "failed" || item.Status.UploadStatus == "deleted":
+			return model.UnavailableRejected
+		}
+	}
+	if y.Region == "" || item.ContentDetails == nil || item.ContentDetails.RegionRestriction == nil {
+		return ""
+	}
+
+	restriction := item.ContentDetails.RegionRestriction
+	for _, r := range restriction.Blocked {
+		if r == y.Region {
+			return model.UnavailableRegionBlocked
+		}
+	}
+	if len(restriction.Allowed) == 0 {
+		return ""
+	}
+	for _, r := range restriction.Allowed {
+		if r == y.Region {
+			return ""
+		}
+	}
+
+	return model.UnavailableRegionBlocked
+}
+
+// statistics returns zero for the counts that the owner of the video hides
+func statistics(s *youtube.VideoStatistics) Statistics {
+	if s == nil {
+		return Statistics{}
+	}
+
+	return Statistics{
+		ViewCount:    int64(s.ViewCount),
+		LikeCount:    int64(s.LikeCount),
+		CommentCount: int64(s.CommentCount),
+	}
+}
+
+func (y *Youtube) FetchChannels(channelIDs []model.YoutubeChannelID) (map[model.YoutubeChannelID]ChannelMetadata, error) {
+	strIDs := make([]string, len(channelIDs))
+	for i, id := range channelIDs {
+		strIDs[i] = string(id)
+	}
+	call := y.Client.Channels.
+		List([]string{"snippet,statistics"}).
+		Id(strings.Join(strIDs, ",")).
+		MaxResults(50)
+
+	start := time.Now()
+	response, err := call.Do()
+	observe("channels", start, err)
+	if err != nil {
+		return map[model.YoutubeChannelID]ChannelMetadata{}, err
+	}
+
+	mds := make(map[model.YoutubeChannelID]ChannelMetadata, len(response.Items))
+	for _, item := range response.Items {
+		if item.Snippet == nil {
+			continue
+		}
+		md := ChannelMetadata{
+			Title:           item.Snippet.Title,
+			Handle:          item.Snippet.CustomUrl,
+			Description:     item.Snippet.Description,
+			Thumbnails:      thumbnails(item.Snippet.Thumbnails),
+			Country:         item.Snippet.Country,
+			DefaultLanguage: item.Snippet.DefaultLanguage,
+		}
+		if item.Statistics != nil {
+			// hidden subscriber counts are reported as zero
+			md.SubscriberCount = int64(item.Statistics.SubscriberCount)
+			md.VideoCount = int64(item.Statistics.VideoCount)
+		}
+
+		mds[model.YoutubeChannelID(item.Id)] = md
+	}
+
+	return mds, nil
+}
+
+// PlaylistItems returns a page of the videos in the playlist. Deleted and
+// private videos are left out, they have no owner.
+func (y *Youtube) PlaylistItems(playlistID model.YoutubePlaylistID, pageToken string) ([]PlaylistEntry, string, error) {
+	call := y.Client.PlaylistItems.
+		List([]string{"snippet,contentDetails"}).
+		MaxResults(50).
+		PlaylistId(string(playlistID))
+
+	if pageToken != "" {
+		call.PageToken(pageToken)
+	}
+
+	start := time.Now()
+	response, err := call.Do()
+	observe("playlist_items", start, err)
+	if err != nil {
+		return []PlaylistEntry{}, "", err
+	}
+
+	entries := make([]PlaylistEntry, 0, len(response.Items))
+	for _, item := range response.Items {
+		if item.Snippet == nil || item.ContentDetails == nil || item.Snippet.VideoOwnerChannelId == "" {
+			continue
+		}
+		entries = append(entries, PlaylistEntry{
+			YoutubeID:        model.YoutubeVideoID(item.ContentDetails.VideoId),
+			YoutubeChannelID: model.YoutubeChannelID(item.Snippet.VideoOwnerChannelId),
+			Position:         item.Snippet.Position,
+		})
+	}
+
+	return entries, response.NextPageToken, nil
+}
+
+func (y *Youtube) FetchPlaylists(playlistIDs []model.YoutubePlaylistID) (map[model.YoutubePlaylistID]PlaylistMetadata, error) {
+	strIDs := make([]string, len(playlistIDs))
+	for i, id := range playlistIDs {
+		strIDs[i] = string(id)
+	}
+	call := y.Client.Playlists.
+		List([]string{"snippet,contentDetails"}).
+		Id(strings.Join(strIDs, ",")).
+		MaxResults(50)
+
+	start := time.Now()
+	response, err := call.Do()
+	observe("playlists", start, err)
+	if err != nil {
+		return map[model.YoutubePlaylistID]PlaylistMetadata{}, err
+	}
+
+	mds := make(map[model.YoutubePlaylistID]PlaylistMetadata, len(response.Items))
+	for _, item := range response.Items {
+		if item.Snippet == nil {
+			continue
+		}
+		md := PlaylistMetadata{
+			Title:       item.Snippet.Title,
+			Description: item.Snippet.Description,
+			Thumbnails:  thumbnails(item.Snippet.Thumbnails),
+			ChannelID:   model.YoutubeChannelID(item.Snippet.ChannelId),
+		}
+		if item.ContentDetails != nil {
+			md.ItemCount = item.ContentDetails.ItemCount
+		}
+
+		mds[model.YoutubePlaylistID(item.Id)] = md
+	}
+
+	return mds, nil
+}
+
+func thumbnails(details *youtube.ThumbnailDetails) model.Thumbnails {
+	thumbs := model.Thumbnails{}
+	if details == nil {
+		return thumbs
+	}
+	for size, t := range map[string]*youtube.Thumbnail{
+		"default":  details.Default,
+		"medium":   details.Medium,
+		"high":     details.High,
+		"standard": details.Standard,
+		"maxres":   details.Maxres,
+	} {
+		if t != nil && t.Url != "" {
+			thumbs[size] = t.Url
+		}
+	}
+
+	return thumbs
+}
+
+func observe(method string, start time.Time, err error) {
+	metrics.YoutubeDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+	metrics.YoutubeCalls.WithLabelValues(method, metrics.Result(err)).Inc()
+}
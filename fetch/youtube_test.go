@@ -0,0 +1,214 @@
+package fetch
+
+import (
+	"testing"
+	"time"
+
+	"go-mod.ewintr.nl/yogai/model"
+	"google.golang.org/api/youtube/v3"
+)
+
+func TestClassify(t *testing.T) {
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	scheduled := now.Add(2 * time.Hour)
+	recheck := now.Add(liveRecheckDelay)
+
+	for _, tc := range []struct {
+		name         string
+		item         *youtube.Video
+		expType      model.VideoType
+		expAvailable *time.Time
+		expPremiere  bool
+	}{
+		{
+			name:    "regular",
+			item:    ytVideo("none", "PT20M", nil, 1280, 720),
+			expType: model.VideoTypeRegular,
+		},
+		{
+			name:    "short",
+			item:    ytVideo("none", "PT45S", nil, 720, 1280),
+			expType: model.VideoTypeShort,
+		},
+		{
+			name:    "short without player size",
+			item:    ytVideo("none", "PT45S", nil, 0, 0),
+			expType: model.VideoTypeShort,
+		},
+		{
+			name:    "vertical but long",
+			item:    ytVideo("none", "PT10M", nil, 720, 1280),
+			expType: model.VideoTypeRegular,
+		},
+		{
+			name:         "upcoming stream",
+			item:         ytVideo("upcoming", "P0D", &youtube.VideoLiveStreamingDetails{ScheduledStartTime: scheduled.Format(time.RFC3339)}, 1280, 720),
+			expType:      model.VideoTypeUpcoming,
+			expAvailable: &scheduled,
+		},
+		{
+			name:         "upcoming premiere",
+			item:         ytVideo("upcoming", "PT30M", &youtube.VideoLiveStreamingDetails{ScheduledStartTime: scheduled.Format(time.RFC3339)}, 1280, 720),
+			expType:      model.VideoTypeUpcoming,
+			expAvailable: &scheduled,
+			expPremiere:  true,
+		},
+		{
+			name:         "upcoming past schedule",
+			item:         ytVideo("upcoming", "P0D", &youtube.VideoLiveStreamingDetails{ScheduledStartTime: now.Add(-time.Hour).Format(time.RFC3339)}, 1280, 720),
+			expType:      model.VideoTypeUpcoming,
+			expAvailable: &recheck,
+		},
+		{
+			name:         "airing premiere",
+			item:         ytVideo("live", "PT30M", &youtube.VideoLiveStreamingDetails{ActualStartTime: now.Add(-10 * time.Minute).Format(time.RFC3339)}, 1280, 720),
+			expType:      model.VideoTypeLive,
+			expAvailable: &recheck,
+			expPremiere:  true,
+		},
+		{
+			name:         "running stream",
+			item:         ytVideo("live", "P0D", &youtube.VideoLiveStreamingDetails{ActualStartTime: now.Add(-10 * time.Minute).Format(time.RFC3339)}, 1280, 720),
+			expType:      model.VideoTypeLive,
+			expAvailable: &recheck,
+		},
+		{
+			name:    "ended stream or aired premiere",
+			item:    ytVideo("none", "PT1H", &youtube.VideoLiveStreamingDetails{ActualStartTime: now.Add(-2 * time.Hour).Format(time.RFC3339)}, 1280, 720),
+			expType: model.VideoTypeLive,
+		},
+		{
+			name:    "no details",
+			item:    &youtube.Video{},
+			expType: model.VideoTypeRegular,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			actType, actAvailable := classify(tc.item, now)
+			if actType != tc.expType {
+				t.Errorf("exp type %s, got %s", tc.expType, actType)
+			}
+			switch {
+			case tc.expAvailable == nil && actAvailable != nil:
+				t.Errorf("exp no available at, got %v", actAvailable)
+			case tc.expAvailable != nil && (actAvailable == nil || !actAvailable.Equal(*tc.expAvailable)):
+				t.Errorf("exp available at %v, got %v", tc.expAvailable, actAvailable)
+			}
+			if act := premiere(tc.item); act != tc.expPremiere {
+				t.Errorf("exp premiere %v, got %v", tc.expPremiere, act)
+			}
+		})
+	}
+}
+
+func ytVideo(broadcast, duration string, live *youtube.VideoLiveStreamingDetails, width, height int64) *youtube.Video {
+	return &youtube.Video{
+		Snippet:              &youtube.VideoSnippet{LiveBroadcastContent: broadcast},
+		ContentDetails:       &youtube.VideoContentDetails{Duration: duration},
+		LiveStreamingDetails: live,
+		Player:               &youtube.VideoPlayer{EmbedWidth: width, EmbedHeight: height},
+	}
+}
+
+func TestSetStatus(t *testing.T) {
+	later := time.Now().Add(time.Hour)
+	regularOnly := []*model.Feed{{VideoTypes: []model.VideoType{model.VideoTypeRegular}}}
+	withLive := []*model.Feed{{VideoTypes: []model.VideoType{model.VideoTypeRegular, model.VideoTypeLive}}}
+
+	for _, tc := range []struct {
+		name        string
+		video       model.Video
+		md          Metadata
+		feeds       []*model.Feed
+		expType     model.VideoType
+		expStatus   model.VideoStatus
+		expPremiere bool
+	}{
+		{
+			name:      "regular",
+			md:        Metadata{Type: model.VideoTypeRegular},
+			feeds:     regularOnly,
+			expType:   model.VideoTypeRegular,
+			expStatus: model.StatusFetched,
+		},
+		{
+			name:      "short on regular feed",
+			md:        Metadata{Type: model.VideoTypeShort},
+			feeds:     regularOnly,
+			expType:   model.VideoTypeShort,
+			expStatus: model.StatusSkipped,
+		},
+		{
+			name:        "upcoming premiere",
+			md:          Metadata{Type: model.VideoTypeUpcoming, Premiere: true, AvailableAt: &later},
+			feeds:       regularOnly,
+			expType:     model.VideoTypeUpcoming,
+			expStatus:   model.StatusNew,
+			expPremiere: true,
+		},
+		{
+			name:        "airing premiere on regular feed",
+			md:          Metadata{Type: model.VideoTypeLive, Premiere: true, AvailableAt: &later},
+			feeds:       regularOnly,
+			expType:     model.VideoTypeLive,
+			expStatus:   model.StatusNew,
+			expPremiere: true,
+		},
+		{
+			name:        "aired premiere on regular feed",
+			video:       model.Video{Premiere: true},
+			md:          Metadata{Type: model.VideoTypeLive},
+			feeds:       regularOnly,
+			expType:     model.VideoTypeRegular,
+			expStatus:   model.StatusFetched,
+			expPremiere: true,
+		},
+		{
+			name:      "running stream",
+			md:        Metadata{Type: model.VideoTypeLive, AvailableAt: &later},
+			feeds:     withLive,
+			expType:   model.VideoTypeLive,
+			expStatus: model.StatusNew,
+		},
+		{
+			name:      "ended stream on regular feed",
+			md:        Metadata{Type: model.VideoTypeLive},
+			feeds:     regularOnly,
+			expType:   model.VideoTypeLive,
+			expStatus: model.StatusSkipped,
+		},
+		{
+			name:      "ended stream on live feed",
+			md:        Metadata{Type: model.VideoTypeLive},
+			feeds:     withLive,
+			expType:   model.VideoTypeLive,
+			expStatus: model.StatusFetched,
+		},
+		{
+			name:      "requested short",
+			video:     model.Video{Requested: true},
+			md:        Metadata{Type: model.VideoTypeShort},
+			feeds:     regularOnly,
+			expType:   model.VideoTypeShort,
+			expStatus: model.StatusFetched,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			video := tc.video
+			video.Status = model.StatusNew
+			setStatus(&video, tc.md, tc.feeds)
+			if video.Type != tc.expType {
+				t.Errorf("exp type %s, got %s", tc.expType, video.Type)
+			}
+			if video.Status != tc.expStatus {
+				t.Errorf("exp status %s, got %s (%s)", tc.expStatus, video.Status, video.SkipReason)
+			}
+			if (video.Status == model.StatusSkipped) != (video.SkipReason != "") {
+				t.Errorf("exp skip reason only when skipped, got %q", video.SkipReason)
+			}
+			if video.Premiere != tc.expPremiere {
+				t.Errorf("exp premiere %v, got %v", tc.expPremiere, video.Premiere)
+			}
+		})
+	}
+}
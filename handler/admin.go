@@ -0,0 +1,294 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"go-mod.ewintr.nl/yogai/model"
+	"go-mod.ewintr.nl/yogai/storage"
+	"go-mod.ewintr.nl/yogai/youtubeurl"
+	"github.com/google/uuid"
+	"golang.org/x/exp/slog"
+)
+
+type Reprocessor interface {
+	Validate(steps []string) error
+	Reprocess(videos []*model.Video, steps []string, actor string) error
+}
+
+// Sources adds feeds and videos to the fetcher
+type Sources interface {
+	AddFeed(feed *model.Feed) error
+	AddVideo(ytID model.YoutubeVideoID, actor string) (*model.Video, error)
+}
+
+type AdminAPI struct {
+	videoRepo   storage.VideoRelRepository
+	feedRepo    storage.FeedRelRepository
+	reprocessor Reprocessor
+	sources     Sources
+	logger      *slog.Logger
+}
+
+func NewAdminAPI(videoRepo storage.VideoRelRepository, feedRepo storage.FeedRelRepository, reprocessor Reprocessor, sources Sources, logger *slog.Logger) *AdminAPI {
+	return &AdminAPI{
+		videoRepo:   videoRepo,
+		feedRepo:    feedRepo,
+		reprocessor: reprocessor,
+		sources:     sources,
+		logger:      logger,
+	}
+}
+
+// reprocessRequest is the body of all reprocess routes. The filter fields are
+// only used by the filter route. Processors can contain "metadata" to fetch
+// the metadata again. Without processors, all processors run again.
+type reprocessRequest struct {
+	IDs              []uuid.UUID `json:"ids"`
+	YoutubeChannelID string      `json:"youtube_channel_id"`
+	Statuses         []string    `json:"statuses"`
+	TitleContains    string      `json:"title_contains"`
+	Processors       []string    `json:"processors"`
+}
+
+func (a *AdminAPI) ReprocessVideo(w http.ResponseWriter, r *http.Request) {
+	id := Param(r, "id")
+	req, ok := a.parseRequest(w, r)
+	if !ok {
+		return
+	}
+
+	video, err := findVideo(a.videoRepo, id)
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		a.returnErr(r.Context(), w, http.StatusNotFound, "video not found", err)
+		return
+	case err != nil:
+		a.returnErr(r.Context(), w, http.StatusInternalServerError, "could not find video", err)
+		return
+	}
+
+	a.reprocess(w, r, []*model.Video{video}, req.Processors)
+}
+
+func (a *AdminAPI) ReprocessChannel(w http.ResponseWriter, r *http.Request) {
+	channelID := Param(r, "id")
+	req, ok := a.parseRequest(w, r)
+	if !ok {
+		return
+	}
+
+	videos, err := a.videoRepo.FindByFilter(model.VideoFilter{YoutubeChannelID: model.YoutubeChannelID(channelID)})
+	if err != nil {
+		a.returnErr(r.Context(), w, http.StatusInternalServerError, "could not find videos", err)
+		return
+	}
+
+	a.reprocess(w, r, videos, req.Processors)
+}
+
+func (a *AdminAPI) ReprocessFilter(w http.ResponseWriter, r *http.Request) {
+	req, ok := a.parseRequest(w, r)
+	if !ok {
+		return
+	}
+
+	filter := model.VideoFilter{
+		IDs:              req.IDs,
+		YoutubeChannelID: model.YoutubeChannelID(req.YoutubeChannelID),
+		TitleContains:    req.TitleContains,
+	}
+	for _, s := range req.Statuses {
+		switch model.VideoStatus(s) {
+		case model.StatusNew, model.StatusFetched, model.StatusReady, model.StatusUnavailable, model.StatusSkipped:
+			filter.Statuses = append(filter.Statuses, model.VideoStatus(s))
+		default:
+			a.returnErr(r.Context(), w, http.StatusBadRequest, "invalid status", fmt.Errorf("status must be one of new, fetched, ready, unavailable or skipped, got %q", s))
+			return
+		}
+	}
+	if len(filter.IDs) == 0 && filter.YoutubeChannelID == "" && len(filter.Statuses) == 0 && filter.TitleContains == "" {
+		a.returnErr(r.Context(), w, http.StatusBadRequest, "invalid filter", fmt.Errorf("filter needs at least one of ids, youtube_channel_id, statuses or title_contains"))
+		return
+	}
+
+	videos, err := a.videoRepo.FindByFilter(filter)
+	if err != nil {
+		a.returnErr(r.Context(), w, http.StatusInternalServerError, "could not find videos", err)
+		return
+	}
+
+	a.reprocess(w, r, videos, req.Processors)
+}
+
+// AddFeed adds a channel or a playlist as a source of videos. The metadata and
+// the existing videos are fetched in the background.
+func (a *AdminAPI) AddFeed(w http.ResponseWriter, r *http.Request) {
+	req := struct {
+		Source    string `json:"source"`
+		YoutubeID string `json:"youtube_id"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		a.returnErr(r.Context(), w, http.StatusBadRequest, "invalid request body", err)
+		return
+	}
+	if req.YoutubeID == "" {
+		a.returnErr(r.Context(), w, http.StatusBadRequest, "invalid feed", fmt.Errorf("youtube_id is required"))
+		return
+	}
+
+	feed := &model.Feed{Source: model.FeedSource(req.Source)}
+	var err error
+	switch feed.Source {
+	case model.FeedSourceChannel:
+		feed.YoutubeChannelID, err = youtubeurl.Channel(req.YoutubeID)
+	case model.FeedSourcePlaylist:
+		feed.YoutubePlaylistID, err = youtubeurl.Playlist(req.YoutubeID)
+	default:
+		err = fmt.Errorf("source must be channel or playlist, got %q", req.Source)
+	}
+	if err != nil {
+		a.returnErr(r.Context(), w, http.StatusBadRequest, "invalid feed", err)
+		return
+	}
+	if Expired(w, r) {
+		return
+	}
+	err = a.sources.AddFeed(feed)
+	switch {
+	case errors.Is(err, storage.ErrExists):
+		a.returnErr(r.Context(), w, http.StatusConflict, "feed already exists", err)
+		return
+	case err != nil:
+		a.returnErr(r.Context(), w, http.StatusInternalServerError, "could not add feed", err)
+		return
+	}
+
+	jsonBody, err := json.Marshal(newRespFeed(feed))
+	if err != nil {
+		a.returnErr(r.Context(), w, http.StatusInternalServerError, "could not marshal response", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	fmt.Fprint(w, string(jsonBody))
+}
+
+type rulesRequest struct {
+	VideoTypes         []string   `json:"video_types"`
+	IncludeTitles      []string   `json:"include_titles"`
+	ExcludeTitles      []string   `json:"exclude_titles"`
+	MinDurationSeconds int64      `json:"min_duration_seconds"`
+	MaxDurationSeconds int64      `json:"max_duration_seconds"`
+	PublishedAfter     *time.Time `json:"published_after"`
+	Keywords           []string   `json:"keywords"`
+}
+
+// SetFeedRules replaces the video types and ingestion rules of a feed. They
+// apply to videos that are fetched from now on, use reprocess with metadata
+// to apply them to existing videos.
+func (a *AdminAPI) SetFeedRules(w http.ResponseWriter, r *http.Request) {
+	req := rulesRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		a.returnErr(r.Context(), w, http.StatusBadRequest, "invalid request body", err)
+		return
+	}
+
+	videoTypes := []model.VideoType{}
+	for _, vt := range req.VideoTypes {
+		switch model.VideoType(vt) {
+		case model.VideoTypeRegular, model.VideoTypeShort, model.VideoTypeLive:
+			videoTypes = append(videoTypes, model.VideoType(vt))
+		default:
+			a.returnErr(r.Context(), w, http.StatusBadRequest, "invalid video type", fmt.Errorf("video type must be one of regular, short or live, got %q", vt))
+			return
+		}
+	}
+	rules := model.IngestRules{
+		IncludeTitles:  req.IncludeTitles,
+		ExcludeTitles:  req.ExcludeTitles,
+		MinDuration:    time.Duration(req.MinDurationSeconds) * time.Second,
+		MaxDuration:    time.Duration(req.MaxDurationSeconds) * time.Second,
+		PublishedAfter: req.PublishedAfter,
+		Keywords:       req.Keywords,
+	}
+	if err := rules.Validate(); err != nil {
+		a.returnErr(r.Context(), w, http.StatusBadRequest, "invalid rules", err)
+		return
+	}
+
+	feed, err := findFeed(a.feedRepo, Param(r, "id"))
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		a.returnErr(r.Context(), w, http.StatusNotFound, "feed not found", err)
+		return
+	case err != nil:
+		a.returnErr(r.Context(), w, http.StatusInternalServerError, "could not find feed", err)
+		return
+	}
+
+	if Expired(w, r) {
+		return
+	}
+	feed.VideoTypes = videoTypes
+	feed.Rules = rules
+	if err := a.feedRepo.SaveRules(feed); err != nil {
+		a.returnErr(r.Context(), w, http.StatusInternalServerError, "could not save feed", err)
+		return
+	}
+
+	jsonBody, err := json.Marshal(newRespFeed(feed))
+	if err != nil {
+		a.returnErr(r.Context(), w, http.StatusInternalServerError, "could not marshal response", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, string(jsonBody))
+}
+
+func (a *AdminAPI) parseRequest(w http.ResponseWriter, r *http.Request) (reprocessRequest, bool) {
+	req := reprocessRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		a.returnErr(r.Context(), w, http.StatusBadRequest, "invalid request body", err)
+		return req, false
+	}
+	if err := a.reprocessor.Validate(req.Processors); err != nil {
+		a.returnErr(r.Context(), w, http.StatusBadRequest, "invalid processors", err)
+		return req, false
+	}
+
+	return req, true
+}
+
+func (a *AdminAPI) reprocess(w http.ResponseWriter, r *http.Request, videos []*model.Video, processors []string) {
+	actor := "admin api"
+	if key := KeyFromContext(r.Context()); key != nil {
+		actor = fmt.Sprintf("admin api (%s)", key.Name)
+	}
+	if Expired(w, r) {
+		return
+	}
+	err := a.reprocessor.Reprocess(videos, processors, actor)
+	switch {
+	case errors.Is(err, storage.ErrConflict):
+		a.returnErr(r.Context(), w, http.StatusConflict, "videos changed while resetting, try again", err)
+		return
+	case err != nil:
+		a.returnErr(r.Context(), w, http.StatusInternalServerError, "could not reprocess videos", err)
+		return
+	}
+
+	a.logger.Info("queued videos for reprocessing", slog.Int("count", len(videos)), slog.Any("processors", processors))
+	Message(w, http.StatusAccepted, "videos queued for reprocessing", map[string]int{"count": len(videos)})
+}
+
+func (a *AdminAPI) returnErr(ctx context.Context, w http.ResponseWriter, status int, message string, err error, details ...any) {
+	a.logger.Error(message, slog.String("request_id", RequestID(ctx)), slog.String("err", err.Error()), slog.String("details", fmt.Sprintf("%+v", details)))
+	Error(w, status, message, err, details...)
+}
@@ -0,0 +1,142 @@
+package handler
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"go-mod.ewintr.nl/yogai/model"
+	"go-mod.ewintr.nl/yogai/storage"
+	"github.com/google/uuid"
+)
+
+func TestAdminReprocess(t *testing.T) {
+	expVideo := func(expSteps []string) func(t *testing.T, f *fakes) {
+		return func(t *testing.T, f *fakes) {
+			if len(f.reprocessed) != 1 || f.reprocessed[0].ID != videoID {
+				t.Errorf("exp video %s to be reprocessed, got %v", videoID, f.reprocessed)
+			}
+			if !reflect.DeepEqual(f.reprocessSteps, expSteps) {
+				t.Errorf("exp steps %v, got %v", expSteps, f.reprocessSteps)
+			}
+			if exp := "admin api (admin)"; f.reprocessActor != exp {
+				t.Errorf("exp actor %q, got %q", exp, f.reprocessActor)
+			}
+		}
+	}
+	expNone := func(t *testing.T, f *fakes) {
+		if f.reprocessed != nil {
+			t.Errorf("exp no videos to be reprocessed, got %v", f.reprocessed)
+		}
+	}
+
+	v := newValidator(t)
+	for _, tc := range []serverTest{
+		{name: "filter", method: http.MethodPost, path: "/admin/reprocess", body: `{"statuses":["ready"],"processors":["summary"]}`, expStatus: http.StatusAccepted, check: expVideo([]string{"summary"})},
+		{name: "without filter", method: http.MethodPost, path: "/admin/reprocess", body: `{}`, expStatus: http.StatusBadRequest, check: expNone},
+		{name: "invalid status", method: http.MethodPost, path: "/admin/reprocess", body: `{"statuses":["done"]}`, expStatus: http.StatusBadRequest, check: expNone},
+		{name: "invalid processor", method: http.MethodPost, path: "/admin/reprocess", body: `{"statuses":["ready"],"processors":["bogus"]}`, expStatus: http.StatusBadRequest, check: expNone},
+		{name: "conflict", method: http.MethodPost, path: "/admin/reprocess", body: `{"title_contains":"flow"}`, setup: func(f *fakes) { f.reprocessErr = storage.ErrConflict }, expStatus: http.StatusConflict},
+		{name: "fails", method: http.MethodPost, path: "/admin/reprocess", body: `{"title_contains":"flow"}`, setup: func(f *fakes) { f.videoErr = errFake }, expStatus: http.StatusInternalServerError, check: expNone},
+		{name: "video by id", method: http.MethodPost, path: "/admin/reprocess/video/" + videoID.String(), expStatus: http.StatusAccepted, check: expVideo(nil)},
+		{name: "video by youtube id", method: http.MethodPost, path: "/admin/reprocess/video/" + string(ytVideoID), body: `{"processors":["classifier"]}`, expStatus: http.StatusAccepted, check: expVideo([]string{"classifier"})},
+		{name: "unknown video", method: http.MethodPost, path: "/admin/reprocess/video/" + uuid.NewString(), expStatus: http.StatusNotFound, check: expNone},
+		{name: "video invalid body", method: http.MethodPost, path: "/admin/reprocess/video/" + videoID.String(), body: `[`, expStatus: http.StatusBadRequest, check: expNone},
+		{name: "video conflict", method: http.MethodPost, path: "/admin/reprocess/video/" + videoID.String(), setup: func(f *fakes) { f.reprocessErr = storage.ErrConflict }, expStatus: http.StatusConflict},
+		{name: "video fails", method: http.MethodPost, path: "/admin/reprocess/video/" + videoID.String(), setup: func(f *fakes) { f.reprocessErr = errFake }, expStatus: http.StatusInternalServerError},
+		{name: "channel", method: http.MethodPost, path: "/admin/reprocess/channel/" + string(channelID), body: `{"processors":["metadata"]}`, expStatus: http.StatusAccepted, check: expVideo([]string{"metadata"})},
+		{name: "channel invalid processor", method: http.MethodPost, path: "/admin/reprocess/channel/" + string(channelID), body: `{"processors":["bogus"]}`, expStatus: http.StatusBadRequest, check: expNone},
+		{name: "channel conflict", method: http.MethodPost, path: "/admin/reprocess/channel/" + string(channelID), setup: func(f *fakes) { f.reprocessErr = storage.ErrConflict }, expStatus: http.StatusConflict},
+		{name: "channel fails", method: http.MethodPost, path: "/admin/reprocess/channel/" + string(channelID), setup: func(f *fakes) { f.videoErr = errFake }, expStatus: http.StatusInternalServerError, check: expNone},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.run(t, v)
+		})
+	}
+}
+
+func TestAdminAddFeed(t *testing.T) {
+	expFeeds := func(exp int) func(t *testing.T, f *fakes) {
+		return func(t *testing.T, f *fakes) {
+			if len(f.feeds) != exp {
+				t.Errorf("exp %d feeds, got %d", exp, len(f.feeds))
+			}
+		}
+	}
+
+	v := newValidator(t)
+	for _, tc := range []serverTest{
+		{name: "channel", method: http.MethodPost, path: "/admin/feed", body: `{"source":"channel","youtube_id":"UCaaaaaaaaaaaaaaaaaaaaaa"}`, expStatus: http.StatusAccepted, check: expFeeds(2)},
+		{name: "playlist url", method: http.MethodPost, path: "/admin/feed", body: `{"source":"playlist","youtube_id":"https://www.youtube.com/playlist?list=` + string(playlistID) + `"}`, expStatus: http.StatusAccepted, check: expFeeds(2)},
+		{name: "invalid body", method: http.MethodPost, path: "/admin/feed", body: `{"source":`, expStatus: http.StatusBadRequest, check: expFeeds(1)},
+		{name: "invalid source", method: http.MethodPost, path: "/admin/feed", body: `{"source":"user","youtube_id":"yoga"}`, expStatus: http.StatusBadRequest, check: expFeeds(1)},
+		{name: "invalid channel", method: http.MethodPost, path: "/admin/feed", body: `{"source":"channel","youtube_id":"yoga"}`, expStatus: http.StatusBadRequest, check: expFeeds(1)},
+		{name: "without id", method: http.MethodPost, path: "/admin/feed", body: `{"source":"channel"}`, expStatus: http.StatusBadRequest, check: expFeeds(1)},
+		{name: "existing", method: http.MethodPost, path: "/admin/feed", body: `{"source":"channel","youtube_id":"` + string(channelID) + `"}`, setup: func(f *fakes) { f.addFeedErr = storage.ErrExists }, expStatus: http.StatusConflict},
+		{name: "fails", method: http.MethodPost, path: "/admin/feed", body: `{"source":"channel","youtube_id":"` + string(channelID) + `"}`, setup: func(f *fakes) { f.addFeedErr = errFake }, expStatus: http.StatusInternalServerError},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.run(t, v)
+		})
+	}
+}
+
+func TestAdminSetFeedRules(t *testing.T) {
+	published := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	expFeed := func(expTypes []model.VideoType, expRules model.IngestRules) func(t *testing.T, f *fakes) {
+		return func(t *testing.T, f *fakes) {
+			feed := f.feeds[0]
+			if !reflect.DeepEqual(feed.VideoTypes, expTypes) {
+				t.Errorf("exp types %v, got %v", expTypes, feed.VideoTypes)
+			}
+			// compare without the compiled expressions
+			act := model.IngestRules{
+				IncludeTitles:  feed.Rules.IncludeTitles,
+				ExcludeTitles:  feed.Rules.ExcludeTitles,
+				MinDuration:    feed.Rules.MinDuration,
+				MaxDuration:    feed.Rules.MaxDuration,
+				PublishedAfter: feed.Rules.PublishedAfter,
+				Keywords:       feed.Rules.Keywords,
+			}
+			if !reflect.DeepEqual(act, expRules) {
+				t.Errorf("exp rules %+v, got %+v", expRules, act)
+			}
+		}
+	}
+	unchanged := expFeed([]model.VideoType{model.VideoTypeRegular, model.VideoTypeLive}, model.IngestRules{})
+
+	v := newValidator(t)
+	for _, tc := range []serverTest{
+		{
+			name:      "all rules",
+			method:    http.MethodPut,
+			path:      "/admin/feed/" + feedID.String() + "/rules",
+			body:      `{"video_types":["regular","short"],"include_titles":["(?i)flow"],"exclude_titles":["(?i)podcast"],"min_duration_seconds":600,"max_duration_seconds":3600,"published_after":"2026-01-01T00:00:00Z","keywords":["yin"]}`,
+			expStatus: http.StatusOK,
+			check: expFeed([]model.VideoType{model.VideoTypeRegular, model.VideoTypeShort}, model.IngestRules{
+				IncludeTitles:  []string{"(?i)flow"},
+				ExcludeTitles:  []string{"(?i)podcast"},
+				MinDuration:    10 * time.Minute,
+				MaxDuration:    time.Hour,
+				PublishedAfter: &published,
+				Keywords:       []string{"yin"},
+			}),
+		},
+		{name: "by channel id", method: http.MethodPut, path: "/admin/feed/" + string(channelID) + "/rules", body: `{"video_types":["short"]}`, expStatus: http.StatusOK, check: expFeed([]model.VideoType{model.VideoTypeShort}, model.IngestRules{})},
+		{name: "reset", method: http.MethodPut, path: "/admin/feed/" + feedID.String() + "/rules", body: `{}`, expStatus: http.StatusOK, check: expFeed([]model.VideoType{}, model.IngestRules{})},
+		{name: "invalid body", method: http.MethodPut, path: "/admin/feed/" + feedID.String() + "/rules", body: `{"video_types":`, expStatus: http.StatusBadRequest, check: unchanged},
+		{name: "invalid type", method: http.MethodPut, path: "/admin/feed/" + feedID.String() + "/rules", body: `{"video_types":["podcast"]}`, expStatus: http.StatusBadRequest, check: unchanged},
+		{name: "upcoming type", method: http.MethodPut, path: "/admin/feed/" + feedID.String() + "/rules", body: `{"video_types":["upcoming"]}`, expStatus: http.StatusBadRequest, check: unchanged},
+		{name: "invalid include", method: http.MethodPut, path: "/admin/feed/" + feedID.String() + "/rules", body: `{"include_titles":["(yoga"]}`, expStatus: http.StatusBadRequest, check: unchanged},
+		{name: "invalid exclude", method: http.MethodPut, path: "/admin/feed/" + feedID.String() + "/rules", body: `{"exclude_titles":["a++"]}`, expStatus: http.StatusBadRequest, check: unchanged},
+		{name: "negative duration", method: http.MethodPut, path: "/admin/feed/" + feedID.String() + "/rules", body: `{"min_duration_seconds":-1}`, expStatus: http.StatusBadRequest, check: unchanged},
+		{name: "min above max", method: http.MethodPut, path: "/admin/feed/" + feedID.String() + "/rules", body: `{"min_duration_seconds":3600,"max_duration_seconds":60}`, expStatus: http.StatusBadRequest, check: unchanged},
+		{name: "unknown feed", method: http.MethodPut, path: "/admin/feed/" + uuid.NewString() + "/rules", body: `{}`, expStatus: http.StatusNotFound, check: unchanged},
+		{name: "fails", method: http.MethodPut, path: "/admin/feed/" + feedID.String() + "/rules", body: `{}`, setup: func(f *fakes) { f.feedErr = errFake }, expStatus: http.StatusInternalServerError},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.run(t, v)
+		})
+	}
+}
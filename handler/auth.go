@@ -0,0 +1,120 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"go-mod.ewintr.nl/yogai/model"
+	"go-mod.ewintr.nl/yogai/storage"
+	"golang.org/x/exp/slog"
+)
+
+var errKeyLookup = errors.New("could not look up api key")
+
+type keyContext struct{}
+
+// KeyFromContext returns the api key that authenticated the request, or nil
+// when the request was let through without a key.
+func KeyFromContext(ctx context.Context) *model.APIKey {
+	key, _ := ctx.Value(keyContext{}).(*model.APIKey)
+	return key
+}
+
+// Auth checks the api key in the Authorization header
+type Auth struct {
+	keyRepo   storage.APIKeyRepository
+	anonymous bool
+	logger    *slog.Logger
+}
+
+// NewAuth creates an Auth that requires a key for every request. With
+// anonymous, requests without an Authorization header are let through, except
+// on the admin routes. That is only meant for the migration of existing
+// clients, requests that do carry a key are still checked.
+func NewAuth(keyRepo storage.APIKeyRepository, anonymous bool, logger *slog.Logger) *Auth {
+	return &Auth{
+		keyRepo:   keyRepo,
+		anonymous: anonymous,
+		logger:    logger,
+	}
+}
+
+// Require only passes requests to next that carry a valid key. Requests that
+// do not change anything need ScopeRead, the others ScopeWrite. minimum raises
+// the scope that is needed for all requests, e.g. to ScopeAdmin. A nil Auth
+// is a configuration error and rejects everything.
+func (a *Auth) Require(minimum model.Scope, next http.Handler) http.Handler {
+	if a == nil {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			Error(w, http.StatusInternalServerError, "could not authenticate request", fmt.Errorf("api authentication is not configured"))
+		})
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if a.anonymous && minimum != model.ScopeAdmin && r.Header.Get("Authorization") == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		key, err := a.authenticate(r)
+		if errors.Is(err, errKeyLookup) {
+			a.logger.Error("could not authenticate request", slog.String("request_id", RequestID(r.Context())), slog.String("error", err.Error()))
+			Error(w, http.StatusInternalServerError, "could not authenticate request", err)
+			return
+		}
+		if err != nil {
+			a.logger.Info("request not authenticated", slog.String("request_id", RequestID(r.Context())), slog.String("path", r.URL.Path), slog.String("error", err.Error()))
+			w.Header().Set("WWW-Authenticate", `Bearer realm="yogai"`)
+			Error(w, http.StatusUnauthorized, "unauthorized", err)
+			return
+		}
+
+		needed := ScopeFor(r.Method)
+		if minimum.Includes(needed) {
+			needed = minimum
+		}
+		if !key.Scope.Includes(needed) {
+			Error(w, http.StatusForbidden, "forbidden", fmt.Errorf("key %q has scope %s, %s is needed", key.Name, key.Scope, needed))
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), keyContext{}, key)))
+	})
+}
+
+// ScopeFor returns the scope that is needed for a request with the method
+func ScopeFor(method string) model.Scope {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return model.ScopeRead
+	default:
+		return model.ScopeWrite
+	}
+}
+
+func (a *Auth) authenticate(r *http.Request) (*model.APIKey, error) {
+	header := r.Header.Get("Authorization")
+	if header == "" {
+		return nil, fmt.Errorf("missing authorization header")
+	}
+	token, ok := strings.CutPrefix(header, "Bearer ")
+	if !ok || token == "" {
+		return nil, fmt.Errorf("authorization header is not a bearer token")
+	}
+
+	key, err := a.keyRepo.FindByHash(model.HashAPIKey(strings.TrimSpace(token)))
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		return nil, fmt.Errorf("unknown api key")
+	case err != nil:
+		return nil, fmt.Errorf("%w: %v", errKeyLookup, err)
+	}
+	if key.Revoked() {
+		return nil, fmt.Errorf("api key %q was revoked", key.Name)
+	}
+
+	return key, nil
+}
@@ -0,0 +1,133 @@
+package handler
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go-mod.ewintr.nl/yogai/model"
+	"golang.org/x/exp/slog"
+)
+
+func TestAuthRequire(t *testing.T) {
+	keys := map[model.Scope]string{}
+	repo := memKeyRepo{&fakes{}}
+	for _, scope := range []model.Scope{model.ScopeRead, model.ScopeWrite, model.ScopeAdmin} {
+		key, token, err := model.NewAPIKey(string(scope), scope)
+		if err != nil {
+			t.Fatalf("exp nil, got %v", err)
+		}
+		repo.keys = append(repo.keys, key)
+		keys[scope] = token
+	}
+	revoked, revokedToken, err := model.NewAPIKey("revoked", model.ScopeAdmin)
+	if err != nil {
+		t.Fatalf("exp nil, got %v", err)
+	}
+	now := time.Now()
+	revoked.RevokedAt = &now
+	repo.keys = append(repo.keys, revoked)
+
+	for _, tc := range []struct {
+		name      string
+		anonymous bool
+		minimum   model.Scope
+		method    string
+		header    string
+		keyErr    error
+		expStatus int
+		expKey    string
+	}{
+		{name: "no header", minimum: model.ScopeRead, method: http.MethodGet, expStatus: http.StatusUnauthorized},
+		{name: "not bearer", minimum: model.ScopeRead, method: http.MethodGet, header: "Basic " + keys[model.ScopeRead], expStatus: http.StatusUnauthorized},
+		{name: "unknown key", minimum: model.ScopeRead, method: http.MethodGet, header: "Bearer yogai_unknown", expStatus: http.StatusUnauthorized},
+		{name: "revoked key", minimum: model.ScopeRead, method: http.MethodGet, header: "Bearer " + revokedToken, expStatus: http.StatusUnauthorized},
+		{name: "lookup fails", minimum: model.ScopeRead, method: http.MethodGet, header: "Bearer " + keys[model.ScopeRead], keyErr: errFake, expStatus: http.StatusInternalServerError},
+		{name: "read key reads", minimum: model.ScopeRead, method: http.MethodGet, header: "Bearer " + keys[model.ScopeRead], expStatus: http.StatusOK, expKey: "read"},
+		{name: "read key writes", minimum: model.ScopeRead, method: http.MethodPost, header: "Bearer " + keys[model.ScopeRead], expStatus: http.StatusForbidden},
+		{name: "write key writes", minimum: model.ScopeRead, method: http.MethodPut, header: "Bearer " + keys[model.ScopeWrite], expStatus: http.StatusOK, expKey: "write"},
+		{name: "write key reads admin", minimum: model.ScopeAdmin, method: http.MethodGet, header: "Bearer " + keys[model.ScopeWrite], expStatus: http.StatusForbidden},
+		{name: "admin key", minimum: model.ScopeAdmin, method: http.MethodPost, header: "Bearer " + keys[model.ScopeAdmin], expStatus: http.StatusOK, expKey: "admin"},
+		{name: "anonymous reads", anonymous: true, minimum: model.ScopeRead, method: http.MethodGet, expStatus: http.StatusOK},
+		{name: "anonymous writes", anonymous: true, minimum: model.ScopeRead, method: http.MethodPost, expStatus: http.StatusOK},
+		{name: "anonymous admin", anonymous: true, minimum: model.ScopeAdmin, method: http.MethodPost, expStatus: http.StatusUnauthorized},
+		{name: "anonymous with unknown key", anonymous: true, minimum: model.ScopeRead, method: http.MethodGet, header: "Bearer yogai_unknown", expStatus: http.StatusUnauthorized},
+		{name: "anonymous with read key writes", anonymous: true, minimum: model.ScopeRead, method: http.MethodPost, header: "Bearer " + keys[model.ScopeRead], expStatus: http.StatusForbidden},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			repo.keyErr = tc.keyErr
+			auth := NewAuth(repo, tc.anonymous, slog.New(slog.NewTextHandler(io.Discard)))
+			var key *model.APIKey
+			h := auth.Require(tc.minimum, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				key = KeyFromContext(r.Context())
+				w.WriteHeader(http.StatusOK)
+			}))
+
+			req := httptest.NewRequest(tc.method, "/", nil)
+			if tc.header != "" {
+				req.Header.Set("Authorization", tc.header)
+			}
+			resp := httptest.NewRecorder()
+			h.ServeHTTP(resp, req)
+			if resp.Code != tc.expStatus {
+				t.Errorf("exp status %d, got %d: %s", tc.expStatus, resp.Code, resp.Body.String())
+			}
+			actKey := ""
+			if key != nil {
+				actKey = key.Name
+			}
+			if actKey != tc.expKey {
+				t.Errorf("exp key %q, got %q", tc.expKey, actKey)
+			}
+		})
+	}
+}
+
+func TestAuthRequireNil(t *testing.T) {
+	var auth *Auth
+	called := false
+	h := auth.Require(model.ScopeRead, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+
+	resp := httptest.NewRecorder()
+	h.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/", nil))
+	if called {
+		t.Errorf("exp request to be rejected, got it passed on")
+	}
+	if resp.Code != http.StatusInternalServerError {
+		t.Errorf("exp status %d, got %d", http.StatusInternalServerError, resp.Code)
+	}
+}
+
+func TestServerScopes(t *testing.T) {
+	v := newValidator(t)
+	for _, vr := range validRequests {
+		type scopeTest struct {
+			name      string
+			scope     model.Scope
+			expStatus int
+		}
+		var tests []scopeTest
+		switch {
+		case vr.scope == "" && !strings.HasPrefix(vr.path, "/admin"):
+			tests = []scopeTest{{"without key", noKey, vr.expStatus}}
+		case strings.HasPrefix(vr.path, "/admin"):
+			tests = []scopeTest{{"without key", noKey, http.StatusUnauthorized}, {"with write key", model.ScopeWrite, http.StatusForbidden}}
+		case vr.method != http.MethodGet:
+			tests = []scopeTest{{"without key", noKey, http.StatusUnauthorized}, {"with read key", model.ScopeRead, http.StatusForbidden}}
+		default:
+			tests = []scopeTest{{"without key", noKey, http.StatusUnauthorized}}
+		}
+		for _, st := range tests {
+			tc := vr
+			tc.name, tc.scope, tc.expStatus, tc.check = vr.name+" "+st.name, st.scope, st.expStatus, nil
+			t.Run(tc.name, func(t *testing.T) {
+				tc.run(t, v)
+			})
+		}
+	}
+}
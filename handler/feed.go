@@ -0,0 +1,176 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"go-mod.ewintr.nl/yogai/model"
+	"go-mod.ewintr.nl/yogai/storage"
+	"github.com/google/uuid"
+	"golang.org/x/exp/slog"
+)
+
+type FeedAPI struct {
+	feedRepo storage.FeedRelRepository
+	logger   *slog.Logger
+}
+
+func NewFeedAPI(feedRepo storage.FeedRelRepository, logger *slog.Logger) *FeedAPI {
+	return &FeedAPI{
+		feedRepo: feedRepo,
+		logger:   logger,
+	}
+}
+
+type respFeed struct {
+	ID                string           `json:"id"`
+	Status            string           `json:"status"`
+	Source            string           `json:"source"`
+	YoutubeChannelID  string           `json:"youtube_channel_id"`
+	YoutubePlaylistID string           `json:"youtube_playlist_id,omitempty"`
+	Title             string           `json:"title"`
+	Handle            string           `json:"handle"`
+	Description       string           `json:"description"`
+	Thumbnails        model.Thumbnails `json:"thumbnails"`
+	SubscriberCount   int64            `json:"subscriber_count"`
+	VideoCount        int64            `json:"video_count"`
+	Country           string           `json:"country"`
+	DefaultLanguage   string           `json:"default_language"`
+	RefreshedAt       *time.Time       `json:"refreshed_at"`
+	VideoTypes        []string         `json:"video_types"`
+	Rules             respRules        `json:"rules"`
+}
+
+type respRules struct {
+	IncludeTitles      []string   `json:"include_titles"`
+	ExcludeTitles      []string   `json:"exclude_titles"`
+	MinDurationSeconds int64      `json:"min_duration_seconds"`
+	MaxDurationSeconds int64      `json:"max_duration_seconds"`
+	PublishedAfter     *time.Time `json:"published_after"`
+	Keywords           []string   `json:"keywords"`
+}
+
+func newRespRules(r model.IngestRules) respRules {
+	nonNil := func(s []string) []string {
+		if s == nil {
+			return []string{}
+		}
+		return s
+	}
+
+	return respRules{
+		IncludeTitles:      nonNil(r.IncludeTitles),
+		ExcludeTitles:      nonNil(r.ExcludeTitles),
+		MinDurationSeconds: int64(r.MinDuration.Seconds()),
+		MaxDurationSeconds: int64(r.MaxDuration.Seconds()),
+		PublishedAfter:     r.PublishedAfter,
+		Keywords:           nonNil(r.Keywords),
+	}
+}
+
+func newRespFeed(f *model.Feed) respFeed {
+	thumbnails := f.YoutubeThumbnails
+	if thumbnails == nil {
+		thumbnails = model.Thumbnails{}
+	}
+	videoTypes := []string{}
+	for _, vt := range f.VideoTypes {
+		videoTypes = append(videoTypes, string(vt))
+	}
+	if len(videoTypes) == 0 {
+		videoTypes = append(videoTypes, string(model.VideoTypeRegular))
+	}
+
+	return respFeed{
+		ID:                f.ID.String(),
+		Status:            string(f.Status),
+		Source:            string(f.Source),
+		YoutubePlaylistID: string(f.YoutubePlaylistID),
+		YoutubeChannelID:  string(f.YoutubeChannelID),
+		Title:             f.Title,
+		Handle:            f.YoutubeHandle,
+		Description:       f.YoutubeDescription,
+		Thumbnails:        thumbnails,
+		SubscriberCount:   f.YoutubeSubscriberCount,
+		VideoCount:        f.YoutubeVideoCount,
+		Country:           f.YoutubeCountry,
+		DefaultLanguage:   f.YoutubeDefaultLanguage,
+		RefreshedAt:       f.RefreshedAt,
+		VideoTypes:        videoTypes,
+		Rules:             newRespRules(f.Rules),
+	}
+}
+
+func (f *FeedAPI) List(w http.ResponseWriter, r *http.Request) {
+	feeds, err := f.feedRepo.FindAll()
+	if err != nil {
+		f.returnErr(r.Context(), w, http.StatusInternalServerError, "could not list feeds", err)
+		return
+	}
+	if Expired(w, r) {
+		return
+	}
+
+	resp := make([]respFeed, 0, len(feeds))
+	for _, feed := range feeds {
+		resp = append(resp, newRespFeed(feed))
+	}
+
+	jsonBody, err := json.Marshal(resp)
+	if err != nil {
+		f.returnErr(r.Context(), w, http.StatusInternalServerError, "could not marshal response", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, string(jsonBody))
+}
+
+// Get returns a single feed. The id is either the id of the feed or the id of
+// its YouTube channel or playlist.
+func (f *FeedAPI) Get(w http.ResponseWriter, r *http.Request) {
+	feed, err := findFeed(f.feedRepo, Param(r, "id"))
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		f.returnErr(r.Context(), w, http.StatusNotFound, "feed not found", err)
+		return
+	case err != nil:
+		f.returnErr(r.Context(), w, http.StatusInternalServerError, "could not find feed", err)
+		return
+	}
+	if Expired(w, r) {
+		return
+	}
+
+	jsonBody, err := json.Marshal(newRespFeed(feed))
+	if err != nil {
+		f.returnErr(r.Context(), w, http.StatusInternalServerError, "could not marshal response", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, string(jsonBody))
+}
+
+// findFeed looks up a feed by its id, by the YouTube id of its channel or by
+// the YouTube id of its playlist
+func findFeed(feedRepo storage.FeedRelRepository, id string) (*model.Feed, error) {
+	if feedID, err := uuid.Parse(id); err == nil {
+		return feedRepo.FindByID(feedID)
+	}
+	feed, err := feedRepo.FindByYoutubeChannelID(model.YoutubeChannelID(id))
+	if !errors.Is(err, storage.ErrNotFound) {
+		return feed, err
+	}
+
+	return feedRepo.FindByYoutubePlaylistID(model.YoutubePlaylistID(id))
+}
+
+func (f *FeedAPI) returnErr(ctx context.Context, w http.ResponseWriter, status int, message string, err error, details ...any) {
+	f.logger.Error(message, slog.String("request_id", RequestID(ctx)), slog.String("err", err.Error()), slog.String("details", fmt.Sprintf("%+v", details)))
+	Error(w, status, message, err, details...)
+}
@@ -0,0 +1,21 @@
+package handler
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestFeedAPI(t *testing.T) {
+	v := newValidator(t)
+	for _, tc := range []serverTest{
+		{name: "list fails", method: http.MethodGet, path: "/feed", setup: func(f *fakes) { f.feedErr = errFake }, expStatus: http.StatusInternalServerError},
+		{name: "get by id", method: http.MethodGet, path: "/feed/" + feedID.String(), expStatus: http.StatusOK},
+		{name: "get by channel id", method: http.MethodGet, path: "/feed/" + string(channelID), expStatus: http.StatusOK},
+		{name: "get unknown", method: http.MethodGet, path: "/feed/" + string(playlistID), expStatus: http.StatusNotFound},
+		{name: "get fails", method: http.MethodGet, path: "/feed/" + feedID.String(), setup: func(f *fakes) { f.feedErr = errFake }, expStatus: http.StatusInternalServerError},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.run(t, v)
+		})
+	}
+}
@@ -6,7 +6,7 @@ import (
 	"net/http"
 )
 
-func Index(w http.ResponseWriter) {
+func Index(w http.ResponseWriter, _ *http.Request) {
 	Message(w, http.StatusOK, "yogai index")
 }
 
@@ -27,6 +27,19 @@ func Message(w http.ResponseWriter, status int, message string, details ...any)
 	fmt.Fprintf(w, string(body))
 }
 
+// Expired answers with a service unavailable error when the context of the
+// request is done, for instance because the deadline of Timeout has passed.
+// Handlers call it after slow work and before they change anything or write
+// the response.
+func Expired(w http.ResponseWriter, r *http.Request) bool {
+	if err := r.Context().Err(); err != nil {
+		Error(w, http.StatusServiceUnavailable, "request timed out", err)
+		return true
+	}
+
+	return false
+}
+
 func Error(w http.ResponseWriter, status int, message string, err error, details ...any) {
 	w.WriteHeader(status)
 	response := struct {
@@ -0,0 +1,195 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// HealthCheck returns an error when a dependency can not be reached. It must
+// return when ctx is done.
+type HealthCheck func(ctx context.Context) error
+
+// CachedCheck wraps check so that it is called at most once per ttl, for
+// dependencies that are slow or expensive to ask. Results of checks that were
+// cut off by the context are not kept.
+func CachedCheck(check HealthCheck, ttl time.Duration) HealthCheck {
+	var mu sync.Mutex
+	var checkedAt time.Time
+	var result error
+
+	return func(ctx context.Context) error {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if !checkedAt.IsZero() && time.Since(checkedAt) < ttl {
+			return result
+		}
+		err := check(ctx)
+		if ctx.Err() != nil {
+			return err
+		}
+		checkedAt, result = time.Now(), err
+
+		return err
+	}
+}
+
+// Health serves the liveness and readiness routes. The service is ready when
+// no startup tasks, like migrations, are running and all dependencies respond
+// within the timeout.
+type Health struct {
+	mu      sync.RWMutex
+	tasks   map[string]bool
+	checks  map[string]HealthCheck
+	timeout time.Duration
+}
+
+func NewHealth(timeout time.Duration) *Health {
+	return &Health{
+		tasks:   map[string]bool{},
+		checks:  map[string]HealthCheck{},
+		timeout: timeout,
+	}
+}
+
+// Start marks the service as not ready until Done is called with the same task
+func (h *Health) Start(task string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.tasks[task] = true
+}
+
+func (h *Health) Done(task string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	delete(h.tasks, task)
+}
+
+func (h *Health) AddCheck(name string, check HealthCheck) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.checks[name] = check
+}
+
+func (h *Health) Live(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	Message(w, http.StatusOK, "alive")
+}
+
+type dependencyStatus struct {
+	Status    string `json:"status"`
+	LatencyMS int64  `json:"latency_ms"`
+	Error     string `json:"error,omitempty"`
+}
+
+func (h *Health) Ready(w http.ResponseWriter, r *http.Request) {
+	h.mu.RLock()
+	tasks := make([]string, 0, len(h.tasks))
+	for task := range h.tasks {
+		tasks = append(tasks, task)
+	}
+	checks := make(map[string]HealthCheck, len(h.checks))
+	for name, check := range h.checks {
+		checks[name] = check
+	}
+	h.mu.RUnlock()
+	sort.Strings(tasks)
+
+	ctx, cancel := context.WithTimeout(r.Context(), h.timeout)
+	defer cancel()
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	deps := make(map[string]dependencyStatus, len(checks))
+	for name, check := range checks {
+		wg.Add(1)
+		go func(name string, check HealthCheck) {
+			defer wg.Done()
+			start := time.Now()
+			err := check(ctx)
+			status := dependencyStatus{
+				Status:    "ok",
+				LatencyMS: time.Since(start).Milliseconds(),
+			}
+			if err != nil {
+				status.Status = "error"
+				status.Error = err.Error()
+			}
+			mu.Lock()
+			deps[name] = status
+			mu.Unlock()
+		}(name, check)
+	}
+	wg.Wait()
+
+	ready := len(tasks) == 0
+	for _, dep := range deps {
+		if dep.Status != "ok" {
+			ready = false
+		}
+	}
+	resp := struct {
+		Ready        bool                        `json:"ready"`
+		Tasks        []string                    `json:"running_tasks,omitempty"`
+		Dependencies map[string]dependencyStatus `json:"dependencies"`
+	}{
+		Ready:        ready,
+		Tasks:        tasks,
+		Dependencies: deps,
+	}
+	body, err := json.Marshal(resp)
+	if err != nil {
+		Error(w, http.StatusInternalServerError, "could not marshal response", err)
+		return
+	}
+
+	status := http.StatusOK
+	if !ready {
+		status = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
+// Startup serves the health routes while the service is starting. All other
+// requests are rejected until the server is set.
+type Startup struct {
+	router *Router
+	server atomic.Pointer[Server]
+}
+
+func NewStartup(health *Health) *Startup {
+	router := NewRouter()
+	router.HandleFunc(http.MethodGet, "/healthz", health.Live)
+	router.HandleFunc(http.MethodGet, "/readyz", health.Ready)
+	router.NotFound = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		Error(w, http.StatusServiceUnavailable, "service is starting", fmt.Errorf("service is not ready yet"))
+	})
+	router.MethodNotAllowed = router.NotFound
+
+	return &Startup{router: router}
+}
+
+func (s *Startup) SetServer(server *Server) {
+	s.server.Store(server)
+}
+
+func (s *Startup) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if server := s.server.Load(); server != nil {
+		server.ServeHTTP(w, r)
+		return
+	}
+
+	s.router.ServeHTTP(w, r)
+}
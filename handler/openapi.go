@@ -0,0 +1,18 @@
+package handler
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+// openAPI describes all routes of the Server. Update it together with the
+// routes and the response types of the apis.
+//
+//go:embed openapi.json
+var openAPI []byte
+
+func OpenAPI(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(openAPI)
+}
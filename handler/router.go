@@ -0,0 +1,115 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+)
+
+type paramsContext struct{}
+
+// Param returns the value of the path parameter with the name, e.g. id for a
+// route registered as /video/{id}
+func Param(r *http.Request, name string) string {
+	params, _ := r.Context().Value(paramsContext{}).(map[string]string)
+	return params[name]
+}
+
+type route struct {
+	method   string
+	segments []string
+	handler  http.Handler
+}
+
+// Router matches requests on method and path. Path segments in braces, like
+// {id}, match any single segment and are available through Param.
+type Router struct {
+	routes           []route
+	NotFound         http.Handler
+	MethodNotAllowed http.Handler
+}
+
+func NewRouter() *Router {
+	return &Router{
+		NotFound: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			Error(w, http.StatusNotFound, "not found", fmt.Errorf("%s is not a valid path", r.URL.Path))
+		}),
+		MethodNotAllowed: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			Error(w, http.StatusMethodNotAllowed, "method not allowed", fmt.Errorf("method %s is not allowed for %s", r.Method, r.URL.Path))
+		}),
+	}
+}
+
+func (rt *Router) Handle(method, pattern string, handler http.Handler) {
+	rt.routes = append(rt.routes, route{
+		method:   method,
+		segments: splitPath(pattern),
+		handler:  handler,
+	})
+}
+
+func (rt *Router) HandleFunc(method, pattern string, handler http.HandlerFunc) {
+	rt.Handle(method, pattern, handler)
+}
+
+func (rt *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	segments := splitPath(r.URL.Path)
+	allowed := []string{}
+	for _, rte := range rt.routes {
+		params, ok := match(rte.segments, segments)
+		if !ok {
+			continue
+		}
+		if rte.method != r.Method {
+			allowed = append(allowed, rte.method)
+			continue
+		}
+		if len(params) > 0 {
+			r = r.WithContext(context.WithValue(r.Context(), paramsContext{}, params))
+		}
+		rte.handler.ServeHTTP(w, r)
+		return
+	}
+
+	if len(allowed) > 0 {
+		sort.Strings(allowed)
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+		rt.MethodNotAllowed.ServeHTTP(w, r)
+		return
+	}
+	rt.NotFound.ServeHTTP(w, r)
+}
+
+func match(pattern, segments []string) (map[string]string, bool) {
+	if len(pattern) != len(segments) {
+		return nil, false
+	}
+
+	var params map[string]string
+	for i, p := range pattern {
+		if strings.HasPrefix(p, "{") && strings.HasSuffix(p, "}") {
+			if params == nil {
+				params = map[string]string{}
+			}
+			params[p[1:len(p)-1]] = segments[i]
+			continue
+		}
+		if p != segments[i] {
+			return nil, false
+		}
+	}
+
+	return params, true
+}
+
+func splitPath(p string) []string {
+	p = strings.Trim(path.Clean("/"+p), "/")
+	if p == "" {
+		return []string{}
+	}
+
+	return strings.Split(p, "/")
+}
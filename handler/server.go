@@ -1,82 +1,88 @@
 package handler
 
 import (
-	"fmt"
 	"net/http"
-	"net/http/httptest"
-	"path"
-	"strings"
+	"time"
 
+	"go-mod.ewintr.nl/yogai/model"
 	"go-mod.ewintr.nl/yogai/storage"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/otel"
 	"golang.org/x/exp/slog"
-	"miniflux.app/logger"
 )
 
+var tracer = otel.Tracer("go-mod.ewintr.nl/yogai/handler")
+
+type ServerConfig struct {
+	// Timeout is the maximum time a request may take, zero means no limit
+	Timeout time.Duration
+	// CORSOrigins are the origins that browsers may call the api from
+	CORSOrigins []string
+}
+
 type Server struct {
-	apis   map[string]http.Handler
-	logger *slog.Logger
+	router  *Router
+	handler http.Handler
+	logger  *slog.Logger
 }
 
-func NewServer(videoRepo storage.VideoRelRepository, logger *slog.Logger) *Server {
-	return &Server{
-		apis: map[string]http.Handler{
-			"video": NewVideoAPI(videoRepo, logger),
-		},
+// NewServer creates the api server. auth must be set, when it is nil all
+// secured apis answer with an error.
+func NewServer(config ServerConfig, videoRepo storage.VideoRelRepository, feedRepo storage.FeedRelRepository, eventRepo storage.VideoEventRepository, usageRepo storage.UsageRepository, reprocessor Reprocessor, sources Sources, auth *Auth, health *Health, logger *slog.Logger) *Server {
+	s := &Server{
+		router: NewRouter(),
 		logger: logger,
 	}
-}
 
-func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	originalPath := r.URL.Path
-	rec := httptest.NewRecorder() // records the response to be able to mix writing headers and content
+	// metrics and health are not measured and need no key
+	s.router.Handle(http.MethodGet, "/metrics", promhttp.Handler())
+	s.router.HandleFunc(http.MethodGet, "/healthz", health.Live)
+	s.router.HandleFunc(http.MethodGet, "/readyz", health.Ready)
 
-	w.Header().Add("Content-Type", "application/json")
+	s.handle(http.MethodGet, "/", http.HandlerFunc(Index))
+	s.handle(http.MethodGet, "/openapi.json", http.HandlerFunc(OpenAPI))
 
-	// route to api
-	head, tail := ShiftPath(r.URL.Path)
-	if len(head) == 0 {
-		Index(rec)
-		returnResponse(w, rec)
-		return
-	}
-	api, ok := s.apis[head]
-	if !ok {
-		Error(rec, http.StatusNotFound, "Not found", fmt.Errorf("%s is not a valid path", r.URL.Path))
-	} else {
-		r.URL.Path = tail
-		api.ServeHTTP(rec, r)
-	}
+	videoAPI := NewVideoAPI(videoRepo, eventRepo, reprocessor, sources, logger)
+	s.handle(http.MethodGet, "/video", auth.Require(model.ScopeRead, http.HandlerFunc(videoAPI.List)))
+	s.handle(http.MethodPost, "/video", auth.Require(model.ScopeWrite, http.HandlerFunc(videoAPI.Add)))
+	s.handle(http.MethodGet, "/video/{id}/history", auth.Require(model.ScopeRead, http.HandlerFunc(videoAPI.History)))
+	s.handle(http.MethodPut, "/video/{id}/classification", auth.Require(model.ScopeWrite, http.HandlerFunc(videoAPI.SetClassification)))
 
-	returnResponse(w, rec)
-	logger.Info("request served", "path", originalPath, "status", rec.Code)
-}
+	feedAPI := NewFeedAPI(feedRepo, logger)
+	s.handle(http.MethodGet, "/feed", auth.Require(model.ScopeRead, http.HandlerFunc(feedAPI.List)))
+	s.handle(http.MethodGet, "/feed/{id}", auth.Require(model.ScopeRead, http.HandlerFunc(feedAPI.Get)))
 
-func returnResponse(w http.ResponseWriter, rec *httptest.ResponseRecorder) {
-	w.WriteHeader(rec.Code)
-	for k, v := range rec.Header() {
-		w.Header()[k] = v
-	}
-	w.Write(rec.Body.Bytes())
+	usageAPI := NewUsageAPI(usageRepo, logger)
+	s.handle(http.MethodGet, "/usage", auth.Require(model.ScopeRead, http.HandlerFunc(usageAPI.Summary)))
+
+	adminAPI := NewAdminAPI(videoRepo, feedRepo, reprocessor, sources, logger)
+	s.handle(http.MethodPost, "/admin/reprocess", auth.Require(model.ScopeAdmin, http.HandlerFunc(adminAPI.ReprocessFilter)))
+	s.handle(http.MethodPost, "/admin/reprocess/video/{id}", auth.Require(model.ScopeAdmin, http.HandlerFunc(adminAPI.ReprocessVideo)))
+	s.handle(http.MethodPost, "/admin/reprocess/channel/{id}", auth.Require(model.ScopeAdmin, http.HandlerFunc(adminAPI.ReprocessChannel)))
+	s.handle(http.MethodPost, "/admin/feed", auth.Require(model.ScopeAdmin, http.HandlerFunc(adminAPI.AddFeed)))
+	s.handle(http.MethodPut, "/admin/feed/{id}/rules", auth.Require(model.ScopeAdmin, http.HandlerFunc(adminAPI.SetFeedRules)))
+
+	s.router.NotFound = instrument("unknown", s.router.NotFound)
+	s.router.MethodNotAllowed = instrument("unknown", s.router.MethodNotAllowed)
+
+	s.handler = Chain(s.router,
+		WithRequestID,
+		AccessLog(logger),
+		Gzip,
+		Recover(logger),
+		CORS(config.CORSOrigins),
+		JSON,
+		Timeout(config.Timeout),
+	)
+
+	return s
 }
 
-// ShiftPath splits off the first component of p, which will be cleaned of
-// relative components before processing. head will never contain a slash and
-// tail will always be a rooted path without trailing slash.
-// See https://blog.merovius.de/posts/2017-06-18-how-not-to-use-an-http-router/
-func ShiftPath(p string) (string, string) {
-	p = path.Clean("/" + p)
-
-	// restore iri prefixes that might be mangled by path.Clean
-	for k, v := range map[string]string{
-		"http:/":  "http://",
-		"https:/": "https://",
-	} {
-		p = strings.Replace(p, k, v, -1)
-	}
+// handle registers an api route, with metrics and tracing
+func (s *Server) handle(method, pattern string, handler http.Handler) {
+	s.router.Handle(method, pattern, instrument(pattern, handler))
+}
 
-	i := strings.Index(p[1:], "/") + 1
-	if i <= 0 {
-		return p[1:], "/"
-	}
-	return p[1:i], p[i:]
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.handler.ServeHTTP(w, r)
 }
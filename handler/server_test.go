@@ -0,0 +1,565 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"go-mod.ewintr.nl/yogai/model"
+	"go-mod.ewintr.nl/yogai/storage"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/legacy"
+	"github.com/google/uuid"
+	"golang.org/x/exp/slog"
+)
+
+var (
+	errFake = errors.New("fake error")
+
+	videoID    = uuid.MustParse("2b1f4c1e-8f52-4f7e-9d2a-6a4a8b0c9d11")
+	feedID     = uuid.MustParse("6c0a3f55-2d8e-4b9a-a1f3-0b7e4f3c2d22")
+	ytVideoID  = model.YoutubeVideoID("dQw4w9WgXcQ")
+	channelID  = model.YoutubeChannelID("UCuAXFkgsw1L7xaCfnd5JJOw")
+	playlistID = model.YoutubePlaylistID("PLFgquLnL59alCl_2TQvOiD5Vgm1hCaGSI")
+)
+
+// fakes holds the data and the errors of the fake dependencies of the server
+type fakes struct {
+	videos       []*model.Video
+	feeds        []*model.Feed
+	events       []*model.VideoEvent
+	summaries    []model.UsageSummary
+	keys         []*model.APIKey
+	tokens       map[model.Scope]string
+	videoErr     error
+	feedErr      error
+	eventErr     error
+	usageErr     error
+	keyErr       error
+	reprocessErr error
+	addFeedErr   error
+	addVideoErr  error
+	unhealthy    bool
+
+	// reprocessed are the videos, steps and actor of the last reprocess
+	reprocessed    []*model.Video
+	reprocessSteps []string
+	reprocessActor string
+}
+
+func newFakes(t *testing.T) *fakes {
+	refreshed := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	f := &fakes{
+		videos: []*model.Video{{
+			ID:                       videoID,
+			Status:                   model.StatusReady,
+			YoutubeID:                ytVideoID,
+			YoutubeChannelID:         channelID,
+			YoutubeTitle:             "Morning flow",
+			YoutubePublishedAt:       "2026-09-30T06:00:00Z",
+			YoutubeDuration:          "PT20M",
+			YoutubeThumbnails:        model.Thumbnails{"default": "https://i.ytimg.com/vi/dQw4w9WgXcQ/default.jpg"},
+			YoutubeDefinition:        "hd",
+			Type:                     model.VideoTypeRegular,
+			Summary:                  "A gentle flow",
+			Classification:           model.ClassificationPractice,
+			ClassificationConfidence: 0.9,
+			StatisticsRefreshedAt:    &refreshed,
+		}},
+		feeds: []*model.Feed{{
+			ID:               feedID,
+			Status:           model.FeedStatusReady,
+			Source:           model.FeedSourceChannel,
+			YoutubeChannelID: channelID,
+			Title:            "Yoga channel",
+			RefreshedAt:      &refreshed,
+			VideoTypes:       []model.VideoType{model.VideoTypeRegular, model.VideoTypeLive},
+		}},
+		events: []*model.VideoEvent{
+			{VideoID: videoID, Type: model.EventStatus, Status: model.StatusNew, Actor: "feed reader", CreatedAt: refreshed},
+			{VideoID: videoID, Type: model.EventProcessor, Processor: "summary", Actor: "pipeline", CreatedAt: refreshed},
+		},
+		summaries: []model.UsageSummary{{Key: string(channelID), Runs: 2, PromptTokens: 1000, CompletionTokens: 200, Cost: 0.01}},
+		tokens:    map[model.Scope]string{},
+	}
+	for _, scope := range []model.Scope{model.ScopeRead, model.ScopeWrite, model.ScopeAdmin} {
+		key, token, err := model.NewAPIKey(string(scope), scope)
+		if err != nil {
+			t.Fatalf("exp nil, got %v", err)
+		}
+		f.keys = append(f.keys, key)
+		f.tokens[scope] = token
+	}
+
+	return f
+}
+
+func (f *fakes) server() *Server {
+	logger := slog.New(slog.NewTextHandler(io.Discard))
+	health := NewHealth(time.Second)
+	if f.unhealthy {
+		health.AddCheck("postgres", func(ctx context.Context) error { return errFake })
+	}
+
+	return NewServer(ServerConfig{Timeout: time.Minute}, memVideoRepo{f}, memFeedRepo{f}, memEventRepo{f}, memUsageRepo{f}, fakeReprocessor{f}, fakeSources{f}, NewAuth(memKeyRepo{f}, false, logger), health, logger)
+}
+
+type memVideoRepo struct{ *fakes }
+
+func (r memVideoRepo) Save(video *model.Video) error {
+	if r.videoErr != nil {
+		return r.videoErr
+	}
+	for i, v := range r.videos {
+		if v.ID == video.ID {
+			r.videos[i] = video
+			return nil
+		}
+	}
+	r.videos = append(r.videos, video)
+
+	return nil
+}
+
+func (r memVideoRepo) FindByID(id uuid.UUID) (*model.Video, error) {
+	return r.find(func(v *model.Video) bool { return v.ID == id })
+}
+
+func (r memVideoRepo) FindByYoutubeID(id model.YoutubeVideoID) (*model.Video, error) {
+	return r.find(func(v *model.Video) bool { return v.YoutubeID == id })
+}
+
+func (r memVideoRepo) find(match func(v *model.Video) bool) (*model.Video, error) {
+	if r.videoErr != nil {
+		return nil, r.videoErr
+	}
+	for _, v := range r.videos {
+		if match(v) {
+			c := *v
+			return &c, nil
+		}
+	}
+
+	return nil, storage.ErrNotFound
+}
+
+func (r memVideoRepo) FindByStatus(statuses ...model.VideoStatus) ([]*model.Video, error) {
+	return r.filter(func(v *model.Video) bool {
+		for _, s := range statuses {
+			if v.Status == s {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+func (r memVideoRepo) FindOutdated(_ string) ([]*model.Video, error) {
+	return r.filter(func(v *model.Video) bool { return false })
+}
+
+func (r memVideoRepo) FindByFilter(filter model.VideoFilter) ([]*model.Video, error) {
+	return r.filter(func(v *model.Video) bool {
+		return filter.YoutubeChannelID == "" || v.YoutubeChannelID == filter.YoutubeChannelID
+	})
+}
+
+func (r memVideoRepo) FindStatisticsBefore(_ time.Time, _ int) ([]*model.Video, error) {
+	return r.filter(func(v *model.Video) bool { return false })
+}
+
+func (r memVideoRepo) filter(match func(v *model.Video) bool) ([]*model.Video, error) {
+	if r.videoErr != nil {
+		return nil, r.videoErr
+	}
+	videos := []*model.Video{}
+	for _, v := range r.videos {
+		if match(v) {
+			c := *v
+			videos = append(videos, &c)
+		}
+	}
+
+	return videos, nil
+}
+
+func (r memVideoRepo) SaveStatistics(_ *model.Video) error { return r.videoErr }
+
+func (r memVideoRepo) CountByStatus() (map[model.VideoStatus]int, error) {
+	return map[model.VideoStatus]int{}, r.videoErr
+}
+
+type memFeedRepo struct{ *fakes }
+
+func (r memFeedRepo) Save(feed *model.Feed) error {
+	if r.feedErr != nil {
+		return r.feedErr
+	}
+	for i, f := range r.feeds {
+		if f.ID == feed.ID {
+			r.feeds[i] = feed
+			return nil
+		}
+	}
+	r.feeds = append(r.feeds, feed)
+
+	return nil
+}
+
+func (r memFeedRepo) SaveMetadata(feed *model.Feed) error { return r.Save(feed) }
+func (r memFeedRepo) SaveStatus(feed *model.Feed) error   { return r.Save(feed) }
+func (r memFeedRepo) SaveRules(feed *model.Feed) error    { return r.Save(feed) }
+
+func (r memFeedRepo) FindByID(id uuid.UUID) (*model.Feed, error) {
+	return r.find(func(f *model.Feed) bool { return f.ID == id })
+}
+
+func (r memFeedRepo) FindByYoutubeChannelID(id model.YoutubeChannelID) (*model.Feed, error) {
+	return r.find(func(f *model.Feed) bool { return f.Source == model.FeedSourceChannel && f.YoutubeChannelID == id })
+}
+
+func (r memFeedRepo) FindByYoutubePlaylistID(id model.YoutubePlaylistID) (*model.Feed, error) {
+	return r.find(func(f *model.Feed) bool { return f.Source == model.FeedSourcePlaylist && f.YoutubePlaylistID == id })
+}
+
+func (r memFeedRepo) find(match func(f *model.Feed) bool) (*model.Feed, error) {
+	if r.feedErr != nil {
+		return nil, r.feedErr
+	}
+	for _, f := range r.feeds {
+		if match(f) {
+			c := *f
+			return &c, nil
+		}
+	}
+
+	return nil, storage.ErrNotFound
+}
+
+func (r memFeedRepo) FindByStatus(_ ...model.FeedStatus) ([]*model.Feed, error) { return r.FindAll() }
+
+func (r memFeedRepo) FindAll() ([]*model.Feed, error) {
+	if r.feedErr != nil {
+		return nil, r.feedErr
+	}
+	feeds := []*model.Feed{}
+	for _, f := range r.feeds {
+		c := *f
+		feeds = append(feeds, &c)
+	}
+
+	return feeds, nil
+}
+
+func (r memFeedRepo) FindRefreshedBefore(_ time.Time) ([]*model.Feed, error) { return r.FindAll() }
+
+func (r memFeedRepo) CountByStatus() (map[model.FeedStatus]int, error) {
+	return map[model.FeedStatus]int{}, r.feedErr
+}
+
+type memEventRepo struct{ *fakes }
+
+func (r memEventRepo) Add(event *model.VideoEvent) error {
+	if r.eventErr != nil {
+		return r.eventErr
+	}
+	r.events = append(r.events, event)
+
+	return nil
+}
+
+func (r memEventRepo) FindByVideo(id uuid.UUID) ([]*model.VideoEvent, error) {
+	if r.eventErr != nil {
+		return nil, r.eventErr
+	}
+	events := []*model.VideoEvent{}
+	for _, e := range r.events {
+		if e.VideoID == id {
+			events = append(events, e)
+		}
+	}
+
+	return events, nil
+}
+
+type memUsageRepo struct{ *fakes }
+
+func (r memUsageRepo) Save(_ *model.LLMUsage) error { return r.usageErr }
+
+func (r memUsageRepo) CostSince(_ time.Time) (float64, error) { return 0, r.usageErr }
+
+func (r memUsageRepo) Summarize(_ model.UsageGroup, _ time.Time) ([]model.UsageSummary, error) {
+	if r.usageErr != nil {
+		return nil, r.usageErr
+	}
+
+	return r.summaries, nil
+}
+
+type memKeyRepo struct{ *fakes }
+
+func (r memKeyRepo) Save(key *model.APIKey) error {
+	r.keys = append(r.keys, key)
+	return r.keyErr
+}
+
+func (r memKeyRepo) FindByHash(hash string) (*model.APIKey, error) {
+	if r.keyErr != nil {
+		return nil, r.keyErr
+	}
+	for _, k := range r.keys {
+		if k.Hash == hash {
+			return k, nil
+		}
+	}
+
+	return nil, storage.ErrNotFound
+}
+
+func (r memKeyRepo) FindAll() ([]*model.APIKey, error) { return r.keys, r.keyErr }
+
+func (r memKeyRepo) Revoke(_ uuid.UUID) error { return r.keyErr }
+
+type fakeReprocessor struct{ *fakes }
+
+func (r fakeReprocessor) Validate(steps []string) error {
+	for _, s := range steps {
+		switch s {
+		case "metadata", "classifier", "summary":
+		default:
+			return fmt.Errorf("unknown processor %q", s)
+		}
+	}
+
+	return nil
+}
+
+func (r fakeReprocessor) Reprocess(videos []*model.Video, steps []string, actor string) error {
+	if r.reprocessErr != nil {
+		return r.reprocessErr
+	}
+	r.reprocessed, r.reprocessSteps, r.reprocessActor = videos, steps, actor
+
+	return nil
+}
+
+type fakeSources struct{ *fakes }
+
+func (s fakeSources) AddFeed(feed *model.Feed) error {
+	if s.addFeedErr != nil {
+		return s.addFeedErr
+	}
+	feed.ID = uuid.New()
+	feed.Status = model.FeedStatusNew
+
+	return memFeedRepo(s).Save(feed)
+}
+
+func (s fakeSources) AddVideo(ytID model.YoutubeVideoID, _ string) (*model.Video, error) {
+	if s.addVideoErr != nil {
+		return nil, s.addVideoErr
+	}
+	video, err := memVideoRepo(s).FindByYoutubeID(ytID)
+	if err == nil {
+		return video, storage.ErrExists
+	}
+	video = &model.Video{
+		ID:               uuid.New(),
+		Status:           model.StatusNew,
+		YoutubeID:        ytID,
+		YoutubeChannelID: channelID,
+		Requested:        true,
+	}
+
+	return video, memVideoRepo(s).Save(video)
+}
+
+// validator checks the responses of the server against openapi.json and
+// remembers which operations were called
+type validator struct {
+	router routers.Router
+	called map[string]bool
+}
+
+func newValidator(t *testing.T) *validator {
+	loader := openapi3.NewLoader()
+	doc, err := loader.LoadFromData(openAPI)
+	if err != nil {
+		t.Fatalf("exp nil, got %v", err)
+	}
+	if err := doc.Validate(loader.Context); err != nil {
+		t.Fatalf("exp valid openapi.json, got %v", err)
+	}
+	router, err := legacy.NewRouter(doc)
+	if err != nil {
+		t.Fatalf("exp nil, got %v", err)
+	}
+
+	return &validator{
+		router: router,
+		called: map[string]bool{},
+	}
+}
+
+func (v *validator) validate(t *testing.T, req *http.Request, resp *httptest.ResponseRecorder) {
+	t.Helper()
+	route, params, err := v.router.FindRoute(req)
+	if err != nil {
+		t.Fatalf("exp route for %s %s in openapi.json, got %v", req.Method, req.URL.Path, err)
+	}
+	v.called[fmt.Sprintf("%s %s", req.Method, route.Path)] = true
+
+	if err := openapi3filter.ValidateResponse(context.Background(), &openapi3filter.ResponseValidationInput{
+		RequestValidationInput: &openapi3filter.RequestValidationInput{
+			Request:    req,
+			PathParams: params,
+			Route:      route,
+		},
+		Status: resp.Code,
+		Header: resp.Header(),
+		Body:   io.NopCloser(bytes.NewReader(resp.Body.Bytes())),
+		Options: &openapi3filter.Options{
+			IncludeResponseStatus: true,
+			MultiError:            true,
+		},
+	}); err != nil {
+		t.Errorf("exp response that matches openapi.json, got %v\nbody: %s", err, resp.Body.String())
+	}
+}
+
+// uncalled returns the operations in openapi.json that were not called
+func (v *validator) uncalled(t *testing.T) []string {
+	doc, err := openapi3.NewLoader().LoadFromData(openAPI)
+	if err != nil {
+		t.Fatalf("exp nil, got %v", err)
+	}
+	missing := []string{}
+	for path, item := range doc.Paths {
+		for method := range item.Operations() {
+			if op := fmt.Sprintf("%s %s", method, path); !v.called[op] {
+				missing = append(missing, op)
+			}
+		}
+	}
+	sort.Strings(missing)
+
+	return missing
+}
+
+// noKey sends a request without api key, the other requests are sent with the
+// key of the scope, or with an admin key when the scope is empty
+const noKey = model.Scope("none")
+
+type serverTest struct {
+	name      string
+	method    string
+	path      string
+	body      string
+	scope     model.Scope
+	expired   bool
+	setup     func(f *fakes)
+	expStatus int
+	// check is called with the fakes after the request
+	check func(t *testing.T, f *fakes)
+}
+
+// run sends the request of the test to a server with fresh fakes and checks
+// the status and the response against openapi.json
+func (tc serverTest) run(t *testing.T, v *validator) {
+	t.Helper()
+	f := newFakes(t)
+	if tc.setup != nil {
+		tc.setup(f)
+	}
+	var body io.Reader
+	if tc.body != "" {
+		body = strings.NewReader(tc.body)
+	}
+	req := httptest.NewRequest(tc.method, tc.path, body)
+	if tc.body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	switch tc.scope {
+	case noKey:
+	case "":
+		req.Header.Set("Authorization", "Bearer "+f.tokens[model.ScopeAdmin])
+	default:
+		req.Header.Set("Authorization", "Bearer "+f.tokens[tc.scope])
+	}
+	if tc.expired {
+		ctx, cancel := context.WithDeadline(req.Context(), time.Now().Add(-time.Second))
+		defer cancel()
+		req = req.WithContext(ctx)
+	}
+
+	resp := httptest.NewRecorder()
+	f.server().ServeHTTP(resp, req)
+	if resp.Code != tc.expStatus {
+		t.Errorf("exp status %d, got %d: %s", tc.expStatus, resp.Code, resp.Body.String())
+	}
+	v.validate(t, req, resp)
+	if tc.check != nil {
+		tc.check(t, f)
+	}
+}
+
+// validRequests succeed with the fakes, one for each route
+var validRequests = []serverTest{
+	{name: "index", method: http.MethodGet, path: "/", expStatus: http.StatusOK},
+	{name: "openapi", method: http.MethodGet, path: "/openapi.json", expStatus: http.StatusOK},
+	{name: "live", method: http.MethodGet, path: "/healthz", expStatus: http.StatusOK},
+	{name: "ready", method: http.MethodGet, path: "/readyz", expStatus: http.StatusOK},
+	{name: "metrics", method: http.MethodGet, path: "/metrics", expStatus: http.StatusOK},
+	{name: "list videos", method: http.MethodGet, path: "/video", scope: model.ScopeRead, expStatus: http.StatusOK},
+	{name: "add video", method: http.MethodPost, path: "/video", body: `{"url":"https://youtu.be/aaaaaaaaaaa?t=10"}`, scope: model.ScopeWrite, expStatus: http.StatusAccepted},
+	{name: "video history", method: http.MethodGet, path: "/video/" + videoID.String() + "/history", scope: model.ScopeRead, expStatus: http.StatusOK},
+	{name: "set classification", method: http.MethodPut, path: "/video/" + string(ytVideoID) + "/classification", body: `{"classification":"other"}`, scope: model.ScopeWrite, expStatus: http.StatusAccepted},
+	{name: "list feeds", method: http.MethodGet, path: "/feed", scope: model.ScopeRead, expStatus: http.StatusOK},
+	{name: "get feed", method: http.MethodGet, path: "/feed/" + string(channelID), scope: model.ScopeRead, expStatus: http.StatusOK},
+	{name: "usage", method: http.MethodGet, path: "/usage?group=channel&since=2026-09-01", scope: model.ScopeRead, expStatus: http.StatusOK},
+	{name: "reprocess filter", method: http.MethodPost, path: "/admin/reprocess", body: `{"statuses":["ready","skipped"],"processors":["summary"]}`, expStatus: http.StatusAccepted},
+	{name: "reprocess video", method: http.MethodPost, path: "/admin/reprocess/video/" + string(ytVideoID), expStatus: http.StatusAccepted},
+	{name: "reprocess channel", method: http.MethodPost, path: "/admin/reprocess/channel/" + string(channelID), body: `{"processors":["metadata"]}`, expStatus: http.StatusAccepted},
+	{name: "add feed", method: http.MethodPost, path: "/admin/feed", body: `{"source":"playlist","youtube_id":"https://www.youtube.com/playlist?list=` + string(playlistID) + `"}`, expStatus: http.StatusAccepted},
+	{name: "set feed rules", method: http.MethodPut, path: "/admin/feed/" + feedID.String() + "/rules", body: `{"video_types":["regular","short"],"exclude_titles":["(?i)podcast"],"max_duration_seconds":3600,"published_after":"2026-01-01T00:00:00Z"}`, expStatus: http.StatusOK},
+}
+
+func TestServer(t *testing.T) {
+	tests := append([]serverTest{}, validRequests...)
+	tests = append(tests, serverTest{name: "not ready", method: http.MethodGet, path: "/readyz", setup: func(f *fakes) { f.unhealthy = true }, expStatus: http.StatusServiceUnavailable})
+
+	v := newValidator(t)
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.run(t, v)
+		})
+	}
+
+	if missing := v.uncalled(t); len(missing) > 0 {
+		t.Errorf("exp all operations in openapi.json to be tested, missing %v", missing)
+	}
+}
+
+func TestServerExpired(t *testing.T) {
+	v := newValidator(t)
+	for _, vr := range validRequests {
+		if vr.scope == "" && !strings.HasPrefix(vr.path, "/admin") {
+			continue
+		}
+		tc := vr
+		tc.expired, tc.expStatus, tc.check = true, http.StatusServiceUnavailable, nil
+		t.Run(tc.name, func(t *testing.T) {
+			tc.run(t, v)
+		})
+	}
+}
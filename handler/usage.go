@@ -0,0 +1,101 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"go-mod.ewintr.nl/yogai/model"
+	"go-mod.ewintr.nl/yogai/storage"
+	"golang.org/x/exp/slog"
+)
+
+type UsageAPI struct {
+	usageRepo storage.UsageRepository
+	logger    *slog.Logger
+}
+
+func NewUsageAPI(usageRepo storage.UsageRepository, logger *slog.Logger) *UsageAPI {
+	return &UsageAPI{
+		usageRepo: usageRepo,
+		logger:    logger,
+	}
+}
+
+// Summary returns the llm spend, grouped by day, channel or processor. The
+// period starts at the date in the since parameter, or 30 days ago.
+func (u *UsageAPI) Summary(w http.ResponseWriter, r *http.Request) {
+	group := model.UsageGroup(r.URL.Query().Get("group"))
+	if group == "" {
+		group = model.UsageGroupDay
+	}
+	switch group {
+	case model.UsageGroupDay, model.UsageGroupChannel, model.UsageGroupProcessor:
+	default:
+		u.returnErr(r.Context(), w, http.StatusBadRequest, "invalid group", fmt.Errorf("group must be one of day, channel or processor, got %q", group))
+		return
+	}
+
+	since := time.Now().AddDate(0, 0, -30)
+	if s := r.URL.Query().Get("since"); s != "" {
+		var err error
+		since, err = time.Parse("2006-01-02", s)
+		if err != nil {
+			u.returnErr(r.Context(), w, http.StatusBadRequest, "invalid since date", err)
+			return
+		}
+	}
+
+	summaries, err := u.usageRepo.Summarize(group, since)
+	if err != nil {
+		u.returnErr(r.Context(), w, http.StatusInternalServerError, "could not summarize usage", err)
+		return
+	}
+	if Expired(w, r) {
+		return
+	}
+
+	type respSummary struct {
+		Key              string  `json:"key"`
+		Runs             int     `json:"runs"`
+		PromptTokens     int     `json:"prompt_tokens"`
+		CompletionTokens int     `json:"completion_tokens"`
+		Cost             float64 `json:"cost"`
+	}
+	resp := struct {
+		Group   model.UsageGroup `json:"group"`
+		Since   string           `json:"since"`
+		Total   float64          `json:"total_cost"`
+		Summary []respSummary    `json:"summary"`
+	}{
+		Group:   group,
+		Since:   since.Format("2006-01-02"),
+		Summary: []respSummary{},
+	}
+	for _, s := range summaries {
+		resp.Total += s.Cost
+		resp.Summary = append(resp.Summary, respSummary{
+			Key:              s.Key,
+			Runs:             s.Runs,
+			PromptTokens:     s.PromptTokens,
+			CompletionTokens: s.CompletionTokens,
+			Cost:             s.Cost,
+		})
+	}
+
+	jsonBody, err := json.Marshal(resp)
+	if err != nil {
+		u.returnErr(r.Context(), w, http.StatusInternalServerError, "could not marshal response", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, string(jsonBody))
+}
+
+func (u *UsageAPI) returnErr(ctx context.Context, w http.ResponseWriter, status int, message string, err error, details ...any) {
+	u.logger.Error(message, slog.String("request_id", RequestID(ctx)), slog.String("err", err.Error()), slog.String("details", fmt.Sprintf("%+v", details)))
+	Error(w, status, message, err, details...)
+}
@@ -0,0 +1,21 @@
+package handler
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestUsageAPI(t *testing.T) {
+	v := newValidator(t)
+	for _, tc := range []serverTest{
+		{name: "per day", method: http.MethodGet, path: "/usage", expStatus: http.StatusOK},
+		{name: "per channel since", method: http.MethodGet, path: "/usage?group=channel&since=2026-09-01", expStatus: http.StatusOK},
+		{name: "invalid group", method: http.MethodGet, path: "/usage?group=month", expStatus: http.StatusBadRequest},
+		{name: "invalid since", method: http.MethodGet, path: "/usage?since=yesterday", expStatus: http.StatusBadRequest},
+		{name: "fails", method: http.MethodGet, path: "/usage", setup: func(f *fakes) { f.usageErr = errFake }, expStatus: http.StatusInternalServerError},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.run(t, v)
+		})
+	}
+}
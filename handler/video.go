@@ -3,34 +3,33 @@ package handler
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"time"
 
 	"go-mod.ewintr.nl/yogai/model"
 	"go-mod.ewintr.nl/yogai/storage"
+	"go-mod.ewintr.nl/yogai/youtubeurl"
+	"github.com/google/uuid"
 	"golang.org/x/exp/slog"
 )
 
 type VideoAPI struct {
-	videoRepo storage.VideoRelRepository
-	logger    *slog.Logger
+	videoRepo   storage.VideoRelRepository
+	eventRepo   storage.VideoEventRepository
+	reprocessor Reprocessor
+	sources     Sources
+	logger      *slog.Logger
 }
 
-func NewVideoAPI(videoRepo storage.VideoRelRepository, logger *slog.Logger) *VideoAPI {
+func NewVideoAPI(videoRepo storage.VideoRelRepository, eventRepo storage.VideoEventRepository, reprocessor Reprocessor, sources Sources, logger *slog.Logger) *VideoAPI {
 	return &VideoAPI{
-		videoRepo: videoRepo,
-		logger:    logger,
-	}
-}
-
-func (v *VideoAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	videoID, _ := ShiftPath(r.URL.Path)
-
-	switch {
-	case r.Method == http.MethodGet && videoID == "":
-		v.List(w, r)
-	default:
-		Error(w, http.StatusNotFound, "not found", fmt.Errorf("method %s with subpath %q was not registered in the repository api", r.Method, videoID))
+		videoRepo:   videoRepo,
+		eventRepo:   eventRepo,
+		reprocessor: reprocessor,
+		sources:     sources,
+		logger:      logger,
 	}
 }
 
@@ -40,18 +39,61 @@ func (v *VideoAPI) List(w http.ResponseWriter, r *http.Request) {
 		v.returnErr(r.Context(), w, http.StatusInternalServerError, "could not list repositories", err)
 		return
 	}
+	if Expired(w, r) {
+		return
+	}
 
 	type respVideo struct {
-		YoutubeID string `json:"youtube_url"`
-		Title     string `json:"title"`
-		Summary   string `json:"summary"`
+		ID                   string             `json:"id"`
+		YoutubeID            string             `json:"youtube_url"`
+		YoutubeChannelID     string             `json:"youtube_channel_id"`
+		Title                string             `json:"title"`
+		Summary              string             `json:"summary"`
+		PublishedAt          string             `json:"published_at"`
+		Duration             string             `json:"duration"`
+		Tags                 []string           `json:"tags"`
+		CategoryID           string             `json:"category_id"`
+		DefaultAudioLanguage string             `json:"default_audio_language"`
+		Thumbnails           model.Thumbnails   `json:"thumbnails"`
+		Caption              bool               `json:"caption"`
+		Definition           string             `json:"definition"`
+		Type                 string             `json:"type"`
+		ViewCount            int64              `json:"view_count"`
+		LikeCount            int64              `json:"like_count"`
+		CommentCount         int64              `json:"comment_count"`
+		StatisticsAt         *time.Time         `json:"statistics_refreshed_at"`
+		Classification       respClassification `json:"classification"`
 	}
 	var resp []respVideo
 	for _, v := range video {
+		tags := v.YoutubeTags
+		if tags == nil {
+			tags = []string{}
+		}
+		thumbnails := v.YoutubeThumbnails
+		if thumbnails == nil {
+			thumbnails = model.Thumbnails{}
+		}
 		resp = append(resp, respVideo{
-			YoutubeID: string(v.YoutubeID),
-			Title:     v.YoutubeTitle,
-			Summary:   v.Summary,
+			ID:                   v.ID.String(),
+			YoutubeID:            string(v.YoutubeID),
+			YoutubeChannelID:     string(v.YoutubeChannelID),
+			Title:                v.YoutubeTitle,
+			Summary:              v.Summary,
+			PublishedAt:          v.YoutubePublishedAt,
+			Duration:             v.YoutubeDuration,
+			Tags:                 tags,
+			CategoryID:           v.YoutubeCategoryID,
+			DefaultAudioLanguage: v.YoutubeDefaultAudioLanguage,
+			Thumbnails:           thumbnails,
+			Caption:              v.YoutubeCaption,
+			Definition:           v.YoutubeDefinition,
+			Type:                 string(v.Type),
+			ViewCount:            v.YoutubeViewCount,
+			LikeCount:            v.YoutubeLikeCount,
+			CommentCount:         v.YoutubeCommentCount,
+			StatisticsAt:         v.StatisticsRefreshedAt,
+			Classification:       newRespClassification(v),
 		})
 	}
 
@@ -65,7 +107,219 @@ func (v *VideoAPI) List(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprintf(w, string(jsonBody))
 }
 
-func (v *VideoAPI) returnErr(_ context.Context, w http.ResponseWriter, status int, message string, err error, details ...any) {
-	v.logger.Error(message, slog.String("err", err.Error()), slog.String("details", fmt.Sprintf("%+v", details)))
+// Add adds a single video by its URL or id. A video that is already known is
+// returned as it is.
+func (v *VideoAPI) Add(w http.ResponseWriter, r *http.Request) {
+	req := struct {
+		URL string `json:"url"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		v.returnErr(r.Context(), w, http.StatusBadRequest, "invalid request body", err)
+		return
+	}
+	ytID, err := youtubeurl.Video(req.URL)
+	if err != nil {
+		v.returnErr(r.Context(), w, http.StatusBadRequest, "invalid video url", err)
+		return
+	}
+
+	actor := "api"
+	if key := KeyFromContext(r.Context()); key != nil {
+		actor = fmt.Sprintf("api (%s)", key.Name)
+	}
+	if Expired(w, r) {
+		return
+	}
+	status := http.StatusAccepted
+	video, err := v.sources.AddVideo(ytID, actor)
+	switch {
+	case errors.Is(err, storage.ErrExists):
+		status = http.StatusOK
+	case errors.Is(err, storage.ErrNotFound):
+		v.returnErr(r.Context(), w, http.StatusNotFound, "video not found on youtube", err)
+		return
+	case err != nil:
+		v.returnErr(r.Context(), w, http.StatusInternalServerError, "could not add video", err)
+		return
+	}
+
+	resp := struct {
+		ID               string `json:"id"`
+		YoutubeID        string `json:"youtube_id"`
+		YoutubeChannelID string `json:"youtube_channel_id"`
+		Status           string `json:"status"`
+	}{
+		ID:               video.ID.String(),
+		YoutubeID:        string(video.YoutubeID),
+		YoutubeChannelID: string(video.YoutubeChannelID),
+		Status:           string(video.Status),
+	}
+	jsonBody, err := json.Marshal(resp)
+	if err != nil {
+		v.returnErr(r.Context(), w, http.StatusInternalServerError, "could not marshal response", err)
+		return
+	}
+
+	w.WriteHeader(status)
+	fmt.Fprint(w, string(jsonBody))
+}
+
+// History returns all recorded status changes and processor runs of the video.
+// The id is either the id of the video or its YouTube id.
+func (v *VideoAPI) History(w http.ResponseWriter, r *http.Request) {
+	video, err := findVideo(v.videoRepo, Param(r, "id"))
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		v.returnErr(r.Context(), w, http.StatusNotFound, "video not found", err)
+		return
+	case err != nil:
+		v.returnErr(r.Context(), w, http.StatusInternalServerError, "could not find video", err)
+		return
+	}
+
+	events, err := v.eventRepo.FindByVideo(video.ID)
+	if err != nil {
+		v.returnErr(r.Context(), w, http.StatusInternalServerError, "could not find history", err)
+		return
+	}
+	if Expired(w, r) {
+		return
+	}
+
+	type respEvent struct {
+		Type           string    `json:"type"`
+		PreviousStatus string    `json:"previous_status,omitempty"`
+		Status         string    `json:"status,omitempty"`
+		Processor      string    `json:"processor,omitempty"`
+		Error          string    `json:"error,omitempty"`
+		Actor          string    `json:"actor"`
+		CreatedAt      time.Time `json:"created_at"`
+	}
+	resp := struct {
+		ID                string             `json:"id"`
+		Status            string             `json:"status"`
+		UnavailableReason string             `json:"unavailable_reason,omitempty"`
+		SkipReason        string             `json:"skip_reason,omitempty"`
+		Classification    respClassification `json:"classification"`
+		History           []respEvent        `json:"history"`
+	}{
+		ID:                video.ID.String(),
+		Status:            string(video.Status),
+		UnavailableReason: video.UnavailableReason,
+		SkipReason:        video.SkipReason,
+		Classification:    newRespClassification(video),
+		History:           []respEvent{},
+	}
+	for _, e := range events {
+		resp.History = append(resp.History, respEvent{
+			Type:           string(e.Type),
+			PreviousStatus: string(e.PreviousStatus),
+			Status:         string(e.Status),
+			Processor:      e.Processor,
+			Error:          e.Error,
+			Actor:          e.Actor,
+			CreatedAt:      e.CreatedAt,
+		})
+	}
+
+	jsonBody, err := json.Marshal(resp)
+	if err != nil {
+		v.returnErr(r.Context(), w, http.StatusInternalServerError, "could not marshal response", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, string(jsonBody))
+}
+
+type respClassification struct {
+	Classification string  `json:"classification"`
+	Confidence     float64 `json:"confidence"`
+	Overridden     bool    `json:"overridden"`
+}
+
+func newRespClassification(video *model.Video) respClassification {
+	return respClassification{
+		Classification: string(video.Classification),
+		Confidence:     video.ClassificationConfidence,
+		Overridden:     video.ClassificationOverridden,
+	}
+}
+
+// SetClassification overrides the outcome of the classifier and queues the
+// video again, so that it is skipped or processed accordingly. A null
+// classification removes the override and lets the classifier decide again.
+func (v *VideoAPI) SetClassification(w http.ResponseWriter, r *http.Request) {
+	req := struct {
+		Classification *string `json:"classification"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		v.returnErr(r.Context(), w, http.StatusBadRequest, "invalid request body", err)
+		return
+	}
+	if req.Classification != nil {
+		switch model.Classification(*req.Classification) {
+		case model.ClassificationPractice, model.ClassificationOther:
+		default:
+			v.returnErr(r.Context(), w, http.StatusBadRequest, "invalid classification", fmt.Errorf("classification must be practice, other or null, got %q", *req.Classification))
+			return
+		}
+	}
+
+	video, err := findVideo(v.videoRepo, Param(r, "id"))
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		v.returnErr(r.Context(), w, http.StatusNotFound, "video not found", err)
+		return
+	case err != nil:
+		v.returnErr(r.Context(), w, http.StatusInternalServerError, "could not find video", err)
+		return
+	}
+
+	if Expired(w, r) {
+		return
+	}
+	video.ClassificationOverridden = false
+	if req.Classification != nil {
+		video.Classification = model.Classification(*req.Classification)
+		video.ClassificationConfidence = 1
+		video.ClassificationVersion = ""
+		video.ClassificationOverridden = true
+	}
+	actor := "api"
+	if key := KeyFromContext(r.Context()); key != nil {
+		actor = fmt.Sprintf("api (%s)", key.Name)
+	}
+	err = v.reprocessor.Reprocess([]*model.Video{video}, []string{"classifier"}, actor)
+	switch {
+	case errors.Is(err, storage.ErrConflict):
+		v.returnErr(r.Context(), w, http.StatusConflict, "video changed while resetting, try again", err)
+		return
+	case err != nil:
+		v.returnErr(r.Context(), w, http.StatusInternalServerError, "could not reprocess video", err)
+		return
+	}
+
+	jsonBody, err := json.Marshal(newRespClassification(video))
+	if err != nil {
+		v.returnErr(r.Context(), w, http.StatusInternalServerError, "could not marshal response", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	fmt.Fprint(w, string(jsonBody))
+}
+
+// findVideo looks up a video by its id or by its YouTube id
+func findVideo(videoRepo storage.VideoRelRepository, id string) (*model.Video, error) {
+	if videoID, err := uuid.Parse(id); err == nil {
+		return videoRepo.FindByID(videoID)
+	}
+
+	return videoRepo.FindByYoutubeID(model.YoutubeVideoID(id))
+}
+
+func (v *VideoAPI) returnErr(ctx context.Context, w http.ResponseWriter, status int, message string, err error, details ...any) {
+	v.logger.Error(message, slog.String("request_id", RequestID(ctx)), slog.String("err", err.Error()), slog.String("details", fmt.Sprintf("%+v", details)))
 	Error(w, status, message, err, details...)
 }
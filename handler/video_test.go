@@ -0,0 +1,56 @@
+package handler
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+
+	"go-mod.ewintr.nl/yogai/model"
+	"go-mod.ewintr.nl/yogai/storage"
+	"github.com/google/uuid"
+)
+
+func TestVideoAPI(t *testing.T) {
+	// the reprocessor saves the video with the new classification
+	expClassification := func(exp model.Classification, overridden bool) func(t *testing.T, f *fakes) {
+		return func(t *testing.T, f *fakes) {
+			if len(f.reprocessed) != 1 {
+				t.Fatalf("exp 1 video to be reprocessed, got %d", len(f.reprocessed))
+			}
+			video := f.reprocessed[0]
+			if video.Classification != exp || video.ClassificationOverridden != overridden {
+				t.Errorf("exp classification %q overridden %v, got %q %v", exp, overridden, video.Classification, video.ClassificationOverridden)
+			}
+			if !reflect.DeepEqual(f.reprocessSteps, []string{"classifier"}) {
+				t.Errorf("exp classifier to run again, got %v", f.reprocessSteps)
+			}
+		}
+	}
+	unchanged := func(t *testing.T, f *fakes) {
+		if f.reprocessed != nil {
+			t.Errorf("exp no videos to be reprocessed, got %v", f.reprocessed)
+		}
+	}
+
+	v := newValidator(t)
+	for _, tc := range []serverTest{
+		{name: "list fails", method: http.MethodGet, path: "/video", setup: func(f *fakes) { f.videoErr = errFake }, expStatus: http.StatusInternalServerError},
+		{name: "add known video", method: http.MethodPost, path: "/video", body: `{"url":"https://www.youtube.com/watch?v=` + string(ytVideoID) + `"}`, expStatus: http.StatusOK},
+		{name: "add with invalid body", method: http.MethodPost, path: "/video", body: `{"url":`, expStatus: http.StatusBadRequest},
+		{name: "add with invalid url", method: http.MethodPost, path: "/video", body: `{"url":"https://vimeo.com/123"}`, expStatus: http.StatusBadRequest},
+		{name: "add unknown on youtube", method: http.MethodPost, path: "/video", body: `{"url":"aaaaaaaaaaa"}`, setup: func(f *fakes) { f.addVideoErr = storage.ErrNotFound }, expStatus: http.StatusNotFound},
+		{name: "add fails", method: http.MethodPost, path: "/video", body: `{"url":"aaaaaaaaaaa"}`, setup: func(f *fakes) { f.addVideoErr = errFake }, expStatus: http.StatusInternalServerError},
+		{name: "history of unknown video", method: http.MethodGet, path: "/video/" + uuid.NewString() + "/history", expStatus: http.StatusNotFound},
+		{name: "history fails", method: http.MethodGet, path: "/video/" + videoID.String() + "/history", setup: func(f *fakes) { f.eventErr = errFake }, expStatus: http.StatusInternalServerError},
+		{name: "override classification", method: http.MethodPut, path: "/video/" + string(ytVideoID) + "/classification", body: `{"classification":"other"}`, expStatus: http.StatusAccepted, check: expClassification(model.ClassificationOther, true)},
+		{name: "reset classification", method: http.MethodPut, path: "/video/" + videoID.String() + "/classification", body: `{"classification":null}`, setup: func(f *fakes) { f.videos[0].ClassificationOverridden = true }, expStatus: http.StatusAccepted, check: expClassification(model.ClassificationPractice, false)},
+		{name: "invalid classification", method: http.MethodPut, path: "/video/" + videoID.String() + "/classification", body: `{"classification":"pilates"}`, expStatus: http.StatusBadRequest, check: unchanged},
+		{name: "classification of unknown video", method: http.MethodPut, path: "/video/bbbbbbbbbbb/classification", body: `{"classification":"practice"}`, expStatus: http.StatusNotFound},
+		{name: "classification conflict", method: http.MethodPut, path: "/video/" + videoID.String() + "/classification", body: `{"classification":"practice"}`, setup: func(f *fakes) { f.reprocessErr = storage.ErrConflict }, expStatus: http.StatusConflict},
+		{name: "classification fails", method: http.MethodPut, path: "/video/" + videoID.String() + "/classification", body: `{"classification":"practice"}`, setup: func(f *fakes) { f.videoErr = errFake }, expStatus: http.StatusInternalServerError},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.run(t, v)
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package metrics
+
+import (
+	"go-mod.ewintr.nl/yogai/storage"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/exp/slog"
+)
+
+// StateCollector reads the number of videos and feeds per status and the
+// depth of the job queues from the database on every scrape
+type StateCollector struct {
+	videoRepo storage.VideoRelRepository
+	feedRepo  storage.FeedRelRepository
+	queue     storage.JobQueue
+	logger    *slog.Logger
+
+	videos *prometheus.Desc
+	feeds  *prometheus.Desc
+	jobs   *prometheus.Desc
+}
+
+func NewStateCollector(videoRepo storage.VideoRelRepository, feedRepo storage.FeedRelRepository, queue storage.JobQueue, logger *slog.Logger) *StateCollector {
+	return &StateCollector{
+		videoRepo: videoRepo,
+		feedRepo:  feedRepo,
+		queue:     queue,
+		logger:    logger,
+		videos:    prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "videos"), "Number of videos per status.", []string{"status"}, nil),
+		feeds:     prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "feeds"), "Number of feeds per status.", []string{"status"}, nil),
+		jobs:      prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "queue_depth"), "Number of jobs per queue.", []string{"queue"}, nil),
+	}
+}
+
+func (c *StateCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.videos
+	ch <- c.feeds
+	ch <- c.jobs
+}
+
+func (c *StateCollector) Collect(ch chan<- prometheus.Metric) {
+	videos, err := c.videoRepo.CountByStatus()
+	if err != nil {
+		c.logger.Error("failed to count videos", slog.String("error", err.Error()))
+	}
+	for status, count := range videos {
+		ch <- prometheus.MustNewConstMetric(c.videos, prometheus.GaugeValue, float64(count), string(status))
+	}
+
+	feeds, err := c.feedRepo.CountByStatus()
+	if err != nil {
+		c.logger.Error("failed to count feeds", slog.String("error", err.Error()))
+	}
+	for status, count := range feeds {
+		ch <- prometheus.MustNewConstMetric(c.feeds, prometheus.GaugeValue, float64(count), string(status))
+	}
+
+	jobs, err := c.queue.Depth()
+	if err != nil {
+		c.logger.Error("failed to count jobs", slog.String("error", err.Error()))
+	}
+	for queue, count := range jobs {
+		ch <- prometheus.MustNewConstMetric(c.jobs, prometheus.GaugeValue, float64(count), string(queue))
+	}
+}
@@ -0,0 +1,71 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const namespace = "yogai"
+
+var (
+	FetchIterations = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "fetch_iterations_total",
+		Help:      "Number of iterations of the fetch loops.",
+	}, []string{"loop"})
+
+	FetchErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "fetch_errors_total",
+		Help:      "Number of errors in the fetch loops.",
+	}, []string{"loop"})
+
+	MetadataBatchSize = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "metadata_batch_size",
+		Help:      "Number of videos per metadata request.",
+		Buckets:   []float64{1, 5, 10, 20, 30, 40, 50},
+	})
+
+	YoutubeCalls = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "youtube_api_calls_total",
+		Help:      "Number of calls to the YouTube API.",
+	}, []string{"method", "result"})
+
+	YoutubeDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "youtube_api_duration_seconds",
+		Help:      "Latency of calls to the YouTube API.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method"})
+
+	ProcessorDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "processor_duration_seconds",
+		Help:      "Duration of a processor run on a video.",
+		Buckets:   []float64{0.1, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300},
+	}, []string{"processor"})
+
+	ProcessorFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "processor_failures_total",
+		Help:      "Number of failed processor runs.",
+	}, []string{"processor"})
+
+	HTTPDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Latency of the HTTP API per route.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method", "status"})
+)
+
+// Result is the label value for the outcome of a call
+func Result(err error) string {
+	if err != nil {
+		return "error"
+	}
+
+	return "ok"
+}
@@ -0,0 +1,79 @@
+package model
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Scope string
+
+const (
+	ScopeRead  Scope = "read"
+	ScopeWrite Scope = "write"
+	ScopeAdmin Scope = "admin"
+)
+
+// scopeLevels orders the scopes. A scope includes all scopes with a lower level.
+var scopeLevels = map[Scope]int{
+	ScopeRead:  1,
+	ScopeWrite: 2,
+	ScopeAdmin: 3,
+}
+
+func ParseScope(s string) (Scope, error) {
+	scope := Scope(s)
+	if _, ok := scopeLevels[scope]; !ok {
+		return "", fmt.Errorf("unknown scope %q", s)
+	}
+
+	return scope, nil
+}
+
+// Includes reports whether a key with scope s may do what requires scope other
+func (s Scope) Includes(other Scope) bool {
+	return scopeLevels[s] >= scopeLevels[other]
+}
+
+const apiKeyPrefix = "yogai_"
+
+// APIKey grants access to the api. Only the hash of the key itself is stored,
+// the plain key is shown once when it is created.
+type APIKey struct {
+	ID        uuid.UUID
+	Name      string
+	Hash      string
+	Scope     Scope
+	CreatedAt time.Time
+	RevokedAt *time.Time
+}
+
+// NewAPIKey generates a new key and returns it together with the plain token
+func NewAPIKey(name string, scope Scope) (*APIKey, string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, "", err
+	}
+	token := apiKeyPrefix + hex.EncodeToString(secret)
+
+	return &APIKey{
+		ID:        uuid.New(),
+		Name:      name,
+		Hash:      HashAPIKey(token),
+		Scope:     scope,
+		CreatedAt: time.Now(),
+	}, token, nil
+}
+
+func HashAPIKey(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func (k *APIKey) Revoked() bool {
+	return k.RevokedAt != nil
+}
@@ -0,0 +1,14 @@
+package model
+
+import "time"
+
+// LLMCacheEntry is the stored output of a processor for a given input
+type LLMCacheEntry struct {
+	Key           string
+	Processor     string
+	PromptVersion string
+	Model         string
+	InputHash     string
+	Output        []byte
+	CreatedAt     time.Time
+}
@@ -0,0 +1,55 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type EventType string
+
+const (
+	EventStatus    EventType = "status"
+	EventProcessor EventType = "processor"
+)
+
+// VideoEvent is an entry in the history of a video. It either records a
+// status transition or a run of a processor.
+type VideoEvent struct {
+	ID             int64
+	VideoID        uuid.UUID
+	Type           EventType
+	PreviousStatus VideoStatus
+	Status         VideoStatus
+	Processor      string
+	Error          string
+	Actor          string
+	CreatedAt      time.Time
+}
+
+func NewStatusEvent(video *Video, previous VideoStatus, actor string) *VideoEvent {
+	return &VideoEvent{
+		VideoID:        video.ID,
+		Type:           EventStatus,
+		PreviousStatus: previous,
+		Status:         video.Status,
+		Actor:          actor,
+		CreatedAt:      time.Now(),
+	}
+}
+
+func NewProcessorEvent(video *Video, processor string, err error, actor string) *VideoEvent {
+	e := &VideoEvent{
+		VideoID:   video.ID,
+		Type:      EventProcessor,
+		Status:    video.Status,
+		Processor: processor,
+		Actor:     actor,
+		CreatedAt: time.Now(),
+	}
+	if err != nil {
+		e.Error = err.Error()
+	}
+
+	return e
+}
@@ -1,17 +1,80 @@
 package model
 
-import "github.com/google/uuid"
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
 
 type FeedStatus string
 
 const (
 	FeedStatusNew   FeedStatus = "new"
 	FeedStatusReady FeedStatus = "ready"
+	// FeedStatusAdHoc is the channel of a video that was added on its own.
+	// The other videos of the channel are not fetched.
+	FeedStatusAdHoc FeedStatus = "ad_hoc"
+)
+
+// FeedSource is where the videos of a feed come from
+type FeedSource string
+
+const (
+	FeedSourceChannel FeedSource = "channel"
+	// FeedSourcePlaylist is a playlist that can contain videos of any
+	// channel. YoutubeChannelID is the channel that owns the playlist.
+	FeedSourcePlaylist FeedSource = "playlist"
 )
 
+// Thumbnails maps the size of a thumbnail, like default, medium or high, to
+// its URL
+type Thumbnails map[string]string
+
 type Feed struct {
-	ID               uuid.UUID
-	Status           FeedStatus
-	Title            string
-	YoutubeChannelID YoutubeChannelID
+	ID                uuid.UUID
+	Status            FeedStatus
+	Source            FeedSource
+	Title             string
+	YoutubeChannelID  YoutubeChannelID
+	YoutubePlaylistID YoutubePlaylistID
+
+	YoutubeHandle          string
+	YoutubeDescription     string
+	YoutubeThumbnails      Thumbnails
+	YoutubeSubscriberCount int64
+	YoutubeVideoCount      int64
+	YoutubeCountry         string
+	YoutubeDefaultLanguage string
+	// RefreshedAt is the last time the channel or playlist metadata was
+	// fetched, nil if that never happened
+	RefreshedAt *time.Time
+
+	// VideoTypes are the types of videos that are processed, the others are
+	// skipped. Without types, only regular videos are processed.
+	VideoTypes []VideoType
+	Rules      IngestRules
+}
+
+// SkipReason returns why the feed does not want the video, or an empty string
+// if it does
+func (f *Feed) SkipReason(video *Video) string {
+	if !f.Ingests(video.Type) {
+		return fmt.Sprintf("feed does not ingest videos of type %s", video.Type)
+	}
+
+	return f.Rules.Check(video)
+}
+
+func (f *Feed) Ingests(t VideoType) bool {
+	if len(f.VideoTypes) == 0 {
+		return t == VideoTypeRegular
+	}
+	for _, vt := range f.VideoTypes {
+		if vt == t {
+			return true
+		}
+	}
+
+	return false
 }
@@ -0,0 +1,187 @@
+package model
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFeedSkipReason(t *testing.T) {
+	cutoff := time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC)
+	video := Video{
+		Type:               VideoTypeRegular,
+		YoutubeTitle:       "Gentle Yin Yoga for the Hips",
+		YoutubeDescription: "A slow practice with a bolster.",
+		YoutubeTags:        []string{"yin", "hips"},
+		YoutubeDuration:    "PT45M",
+		YoutubePublishedAt: "2023-07-01T10:00:00Z",
+	}
+
+	for _, tc := range []struct {
+		name      string
+		feed      Feed
+		video     func(v *Video)
+		expReason string
+	}{
+		{
+			name: "no rules",
+		},
+		{
+			name:      "short without types",
+			video:     func(v *Video) { v.Type = VideoTypeShort },
+			expReason: "type short",
+		},
+		{
+			name:  "short with shorts",
+			feed:  Feed{VideoTypes: []VideoType{VideoTypeRegular, VideoTypeShort}},
+			video: func(v *Video) { v.Type = VideoTypeShort },
+		},
+		{
+			name:      "regular without regulars",
+			feed:      Feed{VideoTypes: []VideoType{VideoTypeLive}},
+			expReason: "type regular",
+		},
+		{
+			name: "title included",
+			feed: Feed{Rules: IngestRules{IncludeTitles: []string{"(?i)nidra", "(?i)yin"}}},
+		},
+		{
+			name:      "title not included",
+			feed:      Feed{Rules: IngestRules{IncludeTitles: []string{"(?i)nidra"}}},
+			expReason: "include rules",
+		},
+		{
+			name:      "title excluded",
+			feed:      Feed{Rules: IngestRules{ExcludeTitles: []string{"Hips$"}}},
+			expReason: "exclude rule",
+		},
+		{
+			name:      "exclude wins from include",
+			feed:      Feed{Rules: IngestRules{IncludeTitles: []string{"Yin"}, ExcludeTitles: []string{"Hips"}}},
+			expReason: "exclude rule",
+		},
+		{
+			name:      "invalid title rule",
+			feed:      Feed{Rules: IngestRules{ExcludeTitles: []string{"("}}},
+			expReason: "invalid title rule",
+		},
+		{
+			name: "within max duration",
+			feed: Feed{Rules: IngestRules{MaxDuration: 45 * time.Minute}},
+		},
+		{
+			name:      "longer than max duration",
+			feed:      Feed{Rules: IngestRules{MaxDuration: 30 * time.Minute}},
+			expReason: "longer than maximum",
+		},
+		{
+			name:      "shorter than min duration",
+			feed:      Feed{Rules: IngestRules{MinDuration: time.Hour}},
+			expReason: "shorter than minimum",
+		},
+		{
+			name:      "unknown duration",
+			feed:      Feed{Rules: IngestRules{MaxDuration: time.Hour}},
+			video:     func(v *Video) { v.YoutubeDuration = "" },
+			expReason: "duration \"\" is unknown",
+		},
+		{
+			name: "published after",
+			feed: Feed{Rules: IngestRules{PublishedAfter: &cutoff}},
+		},
+		{
+			name:      "published before",
+			feed:      Feed{Rules: IngestRules{PublishedAfter: &cutoff}},
+			video:     func(v *Video) { v.YoutubePublishedAt = "2023-05-31T23:59:59Z" },
+			expReason: "before 2023-06-01",
+		},
+		{
+			name:      "unknown publish date",
+			feed:      Feed{Rules: IngestRules{PublishedAfter: &cutoff}},
+			video:     func(v *Video) { v.YoutubePublishedAt = "" },
+			expReason: "publish date \"\" is unknown",
+		},
+		{
+			name: "keywords in title, description and tags",
+			feed: Feed{Rules: IngestRules{Keywords: []string{"YIN", "bolster", "hips"}}},
+		},
+		{
+			name:      "keyword missing",
+			feed:      Feed{Rules: IngestRules{Keywords: []string{"yin", "nidra"}}},
+			expReason: "keyword \"nidra\"",
+		},
+		{
+			name: "all rules pass",
+			feed: Feed{Rules: IngestRules{
+				IncludeTitles:  []string{"Yin"},
+				ExcludeTitles:  []string{"Live"},
+				MinDuration:    30 * time.Minute,
+				MaxDuration:    time.Hour,
+				PublishedAfter: &cutoff,
+				Keywords:       []string{"bolster"},
+			}},
+		},
+		{
+			name: "type is checked before rules",
+			feed: Feed{Rules: IngestRules{
+				ExcludeTitles: []string{"Yin"},
+				MaxDuration:   time.Minute,
+			}},
+			video:     func(v *Video) { v.Type = VideoTypeLive },
+			expReason: "type live",
+		},
+		{
+			name: "title is checked before duration",
+			feed: Feed{Rules: IngestRules{
+				ExcludeTitles: []string{"Yin"},
+				MaxDuration:   time.Minute,
+			}},
+			expReason: "exclude rule",
+		},
+		{
+			name: "compiled rules",
+			feed: func() Feed {
+				f := Feed{Rules: IngestRules{IncludeTitles: []string{"Nidra"}}}
+				f.Rules.Compile()
+				return f
+			}(),
+			expReason: "include rules",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			v := video
+			if tc.video != nil {
+				tc.video(&v)
+			}
+			act := tc.feed.SkipReason(&v)
+			switch {
+			case tc.expReason == "" && act != "":
+				t.Errorf("exp no reason, got %q", act)
+			case !strings.Contains(act, tc.expReason):
+				t.Errorf("exp reason with %q, got %q", tc.expReason, act)
+			}
+		})
+	}
+}
+
+func TestIngestRulesValidate(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		rules  IngestRules
+		expErr bool
+	}{
+		{name: "empty"},
+		{name: "valid", rules: IngestRules{IncludeTitles: []string{"^Yoga"}, MinDuration: time.Minute, MaxDuration: time.Hour}},
+		{name: "invalid include", rules: IngestRules{IncludeTitles: []string{"["}}, expErr: true},
+		{name: "invalid exclude", rules: IngestRules{ExcludeTitles: []string{"a++"}}, expErr: true},
+		{name: "negative duration", rules: IngestRules{MinDuration: -time.Minute}, expErr: true},
+		{name: "min above max", rules: IngestRules{MinDuration: time.Hour, MaxDuration: time.Minute}, expErr: true},
+		{name: "only min", rules: IngestRules{MinDuration: time.Hour}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := tc.rules.Validate(); (err != nil) != tc.expErr {
+				t.Errorf("exp error %v, got %v", tc.expErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Queue string
+
+const (
+	QueueFeed     Queue = "feed"
+	QueueMetadata Queue = "metadata"
+	QueueProcess  Queue = "process"
+)
+
+const (
+	PriorityLow    = -10
+	PriorityNormal = 0
+	PriorityHigh   = 10
+)
+
+// MaxJobAttempts is the number of times a job is tried before it is marked as
+// failed and left alone until the subject is enqueued again
+const MaxJobAttempts = 10
+
+// Job is a unit of work in a queue. The subject is a feed or a video,
+// depending on the queue. Version is raised every time the subject is
+// enqueued again, so a worker can tell whether a new request came in while it
+// held the lease.
+type Job struct {
+	ID        uuid.UUID
+	Queue     Queue
+	SubjectID uuid.UUID
+	Priority  int
+	Attempts  int
+	Version   int
+}
+
+// Exhausted reports whether the job has used up all its attempts
+func (j *Job) Exhausted() bool {
+	return j.Attempts >= MaxJobAttempts
+}
+
+// Backoff is the delay before a failed job is tried again. It grows with the
+// number of attempts, up to an hour.
+func (j *Job) Backoff() time.Duration {
+	delay := time.Duration(j.Attempts*j.Attempts) * time.Minute
+	if delay > time.Hour {
+		return time.Hour
+	}
+
+	return delay
+}
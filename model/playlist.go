@@ -0,0 +1,14 @@
+package model
+
+import "github.com/google/uuid"
+
+type YoutubePlaylistID string
+
+// PlaylistItem links a video to a playlist feed. A video can be in several
+// playlists.
+type PlaylistItem struct {
+	FeedID  uuid.UUID
+	VideoID uuid.UUID
+	// Position is the zero based place of the video in the playlist
+	Position int64
+}
@@ -0,0 +1,134 @@
+package model
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// IngestRules decide which videos of a feed are processed. Empty fields do not
+// filter.
+type IngestRules struct {
+	// IncludeTitles are regular expressions, the title must match one of them
+	IncludeTitles []string
+	// ExcludeTitles are regular expressions, the title must match none of them
+	ExcludeTitles []string
+	MinDuration   time.Duration
+	MaxDuration   time.Duration
+	// PublishedAfter skips videos that were published before it
+	PublishedAfter *time.Time
+	// Keywords must all appear in the title, the description or the tags,
+	// ignoring case
+	Keywords []string
+
+	// the title rules as set by Compile
+	compiled   bool
+	include    []*regexp.Regexp
+	exclude    []*regexp.Regexp
+	compileErr error
+}
+
+// Compile prepares the title rules for Check, so that they are not compiled
+// again for every video. It returns the error of the first rule that does not
+// compile. Check then rejects all videos with that error as reason.
+func (r *IngestRules) Compile() error {
+	r.compiled, r.include, r.exclude, r.compileErr = true, nil, nil, nil
+	for _, expr := range r.IncludeTitles {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			r.compileErr = fmt.Errorf("invalid title rule %q: %w", expr, err)
+			return r.compileErr
+		}
+		r.include = append(r.include, re)
+	}
+	for _, expr := range r.ExcludeTitles {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			r.compileErr = fmt.Errorf("invalid title rule %q: %w", expr, err)
+			return r.compileErr
+		}
+		r.exclude = append(r.exclude, re)
+	}
+
+	return nil
+}
+
+// Validate checks that all regular expressions compile and that the
+// durations make sense
+func (r IngestRules) Validate() error {
+	if err := r.Compile(); err != nil {
+		return err
+	}
+	if r.MinDuration < 0 || r.MaxDuration < 0 {
+		return fmt.Errorf("durations can not be negative")
+	}
+	if r.MaxDuration > 0 && r.MinDuration > r.MaxDuration {
+		return fmt.Errorf("minimum duration %s is longer than maximum duration %s", r.MinDuration, r.MaxDuration)
+	}
+
+	return nil
+}
+
+// Check returns the rule that rejects the video, or an empty string if the
+// video passes all rules. Rules that were not compiled yet are compiled for
+// this check only.
+func (r IngestRules) Check(video *Video) string {
+	if !r.compiled {
+		r.Compile()
+	}
+	if r.compileErr != nil {
+		return r.compileErr.Error()
+	}
+
+	if len(r.include) > 0 {
+		included := false
+		for _, re := range r.include {
+			if re.MatchString(video.YoutubeTitle) {
+				included = true
+				break
+			}
+		}
+		if !included {
+			return fmt.Sprintf("title matches none of the include rules %q", r.IncludeTitles)
+		}
+	}
+	for _, re := range r.exclude {
+		if re.MatchString(video.YoutubeTitle) {
+			return fmt.Sprintf("title matches exclude rule %q", re.String())
+		}
+	}
+
+	if r.MinDuration > 0 || r.MaxDuration > 0 {
+		duration, err := ParseDuration(video.YoutubeDuration)
+		switch {
+		case err != nil:
+			return fmt.Sprintf("duration %q is unknown", video.YoutubeDuration)
+		case r.MinDuration > 0 && duration < r.MinDuration:
+			return fmt.Sprintf("duration %s is shorter than minimum %s", duration, r.MinDuration)
+		case r.MaxDuration > 0 && duration > r.MaxDuration:
+			return fmt.Sprintf("duration %s is longer than maximum %s", duration, r.MaxDuration)
+		}
+	}
+
+	if r.PublishedAfter != nil {
+		published, err := time.Parse(time.RFC3339, video.YoutubePublishedAt)
+		switch {
+		case err != nil:
+			return fmt.Sprintf("publish date %q is unknown", video.YoutubePublishedAt)
+		case published.Before(*r.PublishedAfter):
+			return fmt.Sprintf("published at %s, before %s", published.Format(time.RFC3339), r.PublishedAfter.Format(time.RFC3339))
+		}
+	}
+
+	if len(r.Keywords) > 0 {
+		text := strings.ToLower(strings.Join(append([]string{video.YoutubeTitle, video.YoutubeDescription}, video.YoutubeTags...), "\n"))
+		for _, keyword := range r.Keywords {
+			if !strings.Contains(text, strings.ToLower(keyword)) {
+				return fmt.Sprintf("keyword %q is missing", keyword)
+			}
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,37 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// LLMUsage records the tokens and costs of one processor run on one video
+type LLMUsage struct {
+	VideoID          uuid.UUID
+	Processor        string
+	Model            string
+	PromptTokens     int
+	CompletionTokens int
+	Latency          time.Duration
+	Cost             float64
+	CreatedAt        time.Time
+}
+
+type UsageGroup string
+
+const (
+	UsageGroupDay       UsageGroup = "day"
+	UsageGroupChannel   UsageGroup = "channel"
+	UsageGroupProcessor UsageGroup = "processor"
+)
+
+// UsageSummary is the total usage of all runs that share the same Key, where
+// the key is a day, a channel or a processor, depending on the grouping
+type UsageSummary struct {
+	Key              string
+	Runs             int
+	PromptTokens     int
+	CompletionTokens int
+	Cost             float64
+}
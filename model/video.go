@@ -1,6 +1,13 @@
 package model
 
-import "github.com/google/uuid"
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
 
 type VideoStatus string
 
@@ -8,6 +15,45 @@ const (
 	StatusNew     VideoStatus = "new"
 	StatusFetched VideoStatus = "fetched"
 	StatusReady   VideoStatus = "ready"
+	// StatusUnavailable is for videos that can not be watched, the reason is
+	// in UnavailableReason
+	StatusUnavailable VideoStatus = "unavailable"
+	// StatusSkipped is for videos that the feed does not want, the reason is
+	// in SkipReason
+	StatusSkipped VideoStatus = "skipped"
+)
+
+type VideoType string
+
+const (
+	VideoTypeRegular VideoType = "regular"
+	VideoTypeShort   VideoType = "short"
+	// VideoTypeLive is a livestream that is running or has ended. Premieres
+	// that have aired are regular videos, but only when they were seen before
+	// they aired, see Video.Premiere.
+	VideoTypeLive     VideoType = "live"
+	VideoTypeUpcoming VideoType = "upcoming"
+)
+
+const (
+	// UnavailableMissing means YouTube did not return the video, because it
+	// was deleted or made private
+	UnavailableMissing       = "missing"
+	UnavailablePrivate       = "private"
+	UnavailableRegionBlocked = "region_blocked"
+	UnavailableRejected      = "rejected"
+)
+
+// Classification is the outcome of the relevance classifier
+type Classification string
+
+const (
+	// ClassificationPractice is a video that can be followed along as a
+	// practice session
+	ClassificationPractice Classification = "practice"
+	// ClassificationOther is everything else, like vlogs, podcasts and
+	// channel updates
+	ClassificationOther Classification = "other"
 )
 
 type YoutubeVideoID string
@@ -24,10 +70,85 @@ type Video struct {
 	YoutubeDuration    string
 	YoutubePublishedAt string
 
-	Summary string
+	YoutubeTags                 []string
+	YoutubeCategoryID           string
+	YoutubeDefaultAudioLanguage string
+	YoutubeThumbnails           Thumbnails
+	YoutubeCaption              bool
+	YoutubeDefinition           string
+	Type                        VideoType
+	// Premiere is set when the video was seen as an upcoming or running
+	// premiere. Once it has aired, the API reports it like an ended stream.
+	Premiere bool
+	// Requested is set for videos that were added one by one through the
+	// api. The video types and the rules of the feed do not apply to them.
+	Requested bool
+
+	YoutubeViewCount    int64
+	YoutubeLikeCount    int64
+	YoutubeCommentCount int64
+	// StatisticsRefreshedAt is the last time the counts were fetched, nil if
+	// that never happened
+	StatisticsRefreshedAt *time.Time
+
+	UnavailableReason string
+	// AvailabilityCheckedAt is the last time the metadata was requested
+	AvailabilityCheckedAt *time.Time
+
+	SkipReason string
+
+	// Classification is empty when the classifier did not run yet
+	Classification           Classification
+	ClassificationConfidence float64
+	ClassificationVersion    string
+	// ClassificationOverridden is set when the classification was set
+	// through the API, the classifier then leaves it alone
+	ClassificationOverridden bool
+
+	Summary             string
+	SummaryVersion      string
+	SummaryFinishReason string
+
+	// Version is raised on every save. A save of a video that was changed
+	// since it was read fails, so that for instance a reset for reprocessing
+	// is not overwritten by a pipeline run that was already going on.
+	Version int
 }
 
 type VideoVec struct {
 	ID      uuid.UUID
 	Summary string
 }
+
+// VideoFilter selects videos. Empty fields do not filter.
+type VideoFilter struct {
+	IDs              []uuid.UUID
+	YoutubeChannelID YoutubeChannelID
+	Statuses         []VideoStatus
+	// TitleContains matches titles that contain it literally, ignoring case
+	TitleContains string
+}
+
+var durationRE = regexp.MustCompile(`^P(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+)S)?)?$`)
+
+// ParseDuration parses the ISO 8601 durations that YouTube uses, like PT1H2M3S
+func ParseDuration(s string) (time.Duration, error) {
+	m := durationRE.FindStringSubmatch(s)
+	if m == nil {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+
+	var d time.Duration
+	for i, unit := range []time.Duration{24 * time.Hour, time.Hour, time.Minute, time.Second} {
+		if m[i+1] == "" {
+			continue
+		}
+		n, err := strconv.Atoi(m[i+1])
+		if err != nil {
+			return 0, err
+		}
+		d += time.Duration(n) * unit
+	}
+
+	return d, nil
+}
@@ -0,0 +1,37 @@
+package model
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDuration(t *testing.T) {
+	for _, tc := range []struct {
+		in     string
+		exp    time.Duration
+		expErr bool
+	}{
+		{in: "PT1H2M3S", exp: time.Hour + 2*time.Minute + 3*time.Second},
+		{in: "PT45M", exp: 45 * time.Minute},
+		{in: "PT59S", exp: 59 * time.Second},
+		{in: "PT2H", exp: 2 * time.Hour},
+		{in: "P1DT2H", exp: 26 * time.Hour},
+		{in: "P0D", exp: 0},
+		{in: "PT", exp: 0},
+		{in: "", expErr: true},
+		{in: "1H2M", expErr: true},
+		{in: "PT1.5S", expErr: true},
+		{in: "PT2M1H", expErr: true},
+		{in: "pt1m", expErr: true},
+	} {
+		t.Run(tc.in, func(t *testing.T) {
+			act, err := ParseDuration(tc.in)
+			if (err != nil) != tc.expErr {
+				t.Fatalf("exp error %v, got %v", tc.expErr, err)
+			}
+			if act != tc.exp {
+				t.Errorf("exp %s, got %s", tc.exp, act)
+			}
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package process
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"go-mod.ewintr.nl/yogai/model"
+	"go-mod.ewintr.nl/yogai/storage"
+	"golang.org/x/exp/slog"
+)
+
+// CacheableProcessor is a processor that can tell what its input is and that
+// can export and restore its output, so that it can be wrapped in a
+// CachedProcessor
+type CacheableProcessor interface {
+	VideoProcessor
+	Version() string
+	Model() string
+	Input(video *model.Video) (string, error)
+	Output(video *model.Video) ([]byte, error)
+	Restore(video *model.Video, output []byte) error
+}
+
+// CachedProcessor only runs the wrapped processor if there is no stored output
+// for the same processor, prompt version, model and input
+type CachedProcessor struct {
+	proc      CacheableProcessor
+	cacheRepo storage.LLMCacheRepository
+	logger    *slog.Logger
+}
+
+func NewCachedProcessor(proc CacheableProcessor, cacheRepo storage.LLMCacheRepository, logger *slog.Logger) *CachedProcessor {
+	return &CachedProcessor{
+		proc:      proc,
+		cacheRepo: cacheRepo,
+		logger:    logger,
+	}
+}
+
+func (c *CachedProcessor) Name() string {
+	return c.proc.Name()
+}
+
+func (c *CachedProcessor) Do(ctx context.Context, video *model.Video) (Usage, error) {
+	input, err := c.proc.Input(video)
+	if err != nil {
+		return Usage{}, err
+	}
+	inputHash := hash(input)
+	key := hash(c.proc.Name(), c.proc.Version(), c.proc.Model(), inputHash)
+
+	entry, err := c.cacheRepo.Find(key)
+	switch {
+	case err == nil:
+		if err := c.proc.Restore(video, entry.Output); err != nil {
+			return Usage{}, fmt.Errorf("could not restore cached output: %w", err)
+		}
+		c.logger.Info("used cached output", slog.String("video", string(video.YoutubeID)), slog.String("processor", c.proc.Name()))
+		return Usage{}, nil
+	case !errors.Is(err, storage.ErrNotFound):
+		// a broken cache should not stop the processing
+		c.logger.Error("failed to read cache", slog.String("video", string(video.YoutubeID)), slog.String("processor", c.proc.Name()), slog.String("error", err.Error()))
+	}
+
+	usage, err := c.proc.Do(ctx, video)
+	if err != nil {
+		return usage, err
+	}
+
+	output, err := c.proc.Output(video)
+	if err != nil {
+		return usage, fmt.Errorf("could not export output for cache: %w", err)
+	}
+	if err := c.cacheRepo.Save(&model.LLMCacheEntry{
+		Key:           key,
+		Processor:     c.proc.Name(),
+		PromptVersion: c.proc.Version(),
+		Model:         c.proc.Model(),
+		InputHash:     inputHash,
+		Output:        output,
+		CreatedAt:     time.Now(),
+	}); err != nil {
+		c.logger.Error("failed to save cache", slog.String("video", string(video.YoutubeID)), slog.String("processor", c.proc.Name()), slog.String("error", err.Error()))
+	}
+
+	return usage, nil
+}
+
+func hash(parts ...string) string {
+	h := sha256.New()
+	for _, p := range parts {
+		h.Write([]byte(p))
+		h.Write([]byte{0})
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,184 @@
+package process
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"go-mod.ewintr.nl/yogai/model"
+	"github.com/sashabaranov/go-openai"
+)
+
+// classifierReserve is the number of tokens kept free for the answer, which
+// is a short JSON object
+const classifierReserve = 64
+
+// OpenAIClassifier decides whether a video is a practice session. Only the
+// start of long descriptions is used, that is enough to tell.
+type OpenAIClassifier struct {
+	client    *openai.Client
+	model     string
+	tokenizer *Tokenizer
+	limiter   *RateLimiter
+	prompt    *Prompt
+}
+
+func NewOpenAIClassifier(client *openai.Client, limiter *RateLimiter, prompt *Prompt) (*OpenAIClassifier, error) {
+	tokenizer, err := NewTokenizer(openai.GPT3Dot5Turbo)
+	if err != nil {
+		return nil, err
+	}
+
+	return &OpenAIClassifier{
+		client:    client,
+		model:     openai.GPT3Dot5Turbo,
+		tokenizer: tokenizer,
+		limiter:   limiter,
+		prompt:    prompt,
+	}, nil
+}
+
+func (c *OpenAIClassifier) Name() string {
+	return "openai classifier"
+}
+
+func (c *OpenAIClassifier) Version() string {
+	return c.prompt.Version
+}
+
+func (c *OpenAIClassifier) Model() string {
+	return c.model
+}
+
+// Input is the complete prompt for the video
+func (c *OpenAIClassifier) Input(video *model.Video) (string, error) {
+	msgs, err := c.messages(video)
+	if err != nil {
+		return "", err
+	}
+	var input strings.Builder
+	for _, msg := range msgs {
+		fmt.Fprintf(&input, "%s\n%s\n", msg.Role, msg.Content)
+	}
+
+	return input.String(), nil
+}
+
+type classifierOutput struct {
+	Practice   bool    `json:"practice"`
+	Confidence float64 `json:"confidence"`
+}
+
+func (c *OpenAIClassifier) Output(video *model.Video) ([]byte, error) {
+	return json.Marshal(classifierOutput{
+		Practice:   video.Classification == model.ClassificationPractice,
+		Confidence: video.ClassificationConfidence,
+	})
+}
+
+func (c *OpenAIClassifier) Restore(video *model.Video, output []byte) error {
+	var out classifierOutput
+	if err := json.Unmarshal(output, &out); err != nil {
+		return err
+	}
+	c.apply(video, out)
+
+	return nil
+}
+
+func (c *OpenAIClassifier) Do(ctx context.Context, video *model.Video) (Usage, error) {
+	usage := Usage{Model: c.model}
+	msgs, err := c.messages(video)
+	if err != nil {
+		return usage, err
+	}
+	tokens := c.tokenizer.CountMessages(msgs) + classifierReserve
+	ctx = withTokens(ctx, tokens)
+	if err := c.limiter.Wait(ctx, tokens); err != nil {
+		return usage, err
+	}
+
+	resp, err := c.client.CreateChatCompletion(
+		ctx,
+		openai.ChatCompletionRequest{
+			Model:       c.model,
+			Messages:    msgs,
+			MaxTokens:   classifierReserve,
+			Temperature: 0,
+		})
+	if err != nil {
+		return usage, fmt.Errorf("failed to fetch classification: %w", err)
+	}
+	usage.Add(c.model, resp.Usage)
+
+	if len(resp.Choices) == 0 {
+		return usage, ErrNoChoices
+	}
+	choice := resp.Choices[0]
+	if choice.FinishReason == "content_filter" {
+		return usage, ErrContentFiltered
+	}
+	out, err := parseClassification(choice.Message.Content)
+	if err != nil {
+		return usage, err
+	}
+	c.apply(video, out)
+
+	return usage, nil
+}
+
+func (c *OpenAIClassifier) apply(video *model.Video, out classifierOutput) {
+	video.Classification = model.ClassificationOther
+	if out.Practice {
+		video.Classification = model.ClassificationPractice
+	}
+	video.ClassificationConfidence = out.Confidence
+	video.ClassificationVersion = c.prompt.Version
+}
+
+// messages cuts the description so that the prompt fits in the context
+// window
+func (c *OpenAIClassifier) messages(video *model.Video) ([]openai.ChatCompletionMessage, error) {
+	data := NewPromptData(video)
+	msgs, err := chatMessages(c.prompt, data)
+	if err != nil {
+		return nil, err
+	}
+	available := c.tokenizer.Window() - classifierReserve
+	if c.tokenizer.CountMessages(msgs) <= available {
+		return msgs, nil
+	}
+
+	empty := data
+	empty.Description = ""
+	emptyMsgs, err := chatMessages(c.prompt, empty)
+	if err != nil {
+		return nil, err
+	}
+	size := available - c.tokenizer.CountMessages(emptyMsgs)
+	if size <= 0 {
+		return nil, ErrPromptTooLong
+	}
+	data.Description = c.tokenizer.Split(data.Description, size)[0]
+
+	return chatMessages(c.prompt, data)
+}
+
+// parseClassification reads the JSON answer, models sometimes wrap it in text
+// or a code block
+func parseClassification(content string) (classifierOutput, error) {
+	start, end := strings.Index(content, "{"), strings.LastIndex(content, "}")
+	if start == -1 || end < start {
+		return classifierOutput{}, fmt.Errorf("%w: no json in %q", ErrEmptyResponse, content)
+	}
+	var out classifierOutput
+	if err := json.Unmarshal([]byte(content[start:end+1]), &out); err != nil {
+		return classifierOutput{}, fmt.Errorf("invalid classification %q: %w", content, err)
+	}
+	if out.Confidence < 0 || out.Confidence > 1 {
+		return classifierOutput{}, fmt.Errorf("confidence %v is not between 0 and 1", out.Confidence)
+	}
+
+	return out, nil
+}
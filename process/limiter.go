@@ -0,0 +1,209 @@
+package process
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type limitEntry struct {
+	at     time.Time
+	tokens int
+}
+
+// RateLimiter keeps the requests and tokens that are sent to the LLM api within
+// the per minute budgets. It is meant to be shared by all pipelines. A budget
+// of zero means no limit.
+type RateLimiter struct {
+	mu                sync.Mutex
+	requestsPerMinute int
+	tokensPerMinute   int
+	window            []limitEntry
+	pausedUntil       time.Time
+}
+
+func NewRateLimiter(requestsPerMinute, tokensPerMinute int) *RateLimiter {
+	return &RateLimiter{
+		requestsPerMinute: requestsPerMinute,
+		tokensPerMinute:   tokensPerMinute,
+		window:            []limitEntry{},
+	}
+}
+
+// Wait blocks until a request with the given number of tokens fits in the
+// budgets and then registers it.
+func (l *RateLimiter) Wait(ctx context.Context, tokens int) error {
+	for {
+		wait := l.reserve(tokens)
+		if wait <= 0 {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// Pause stops all requests for the duration d, for instance when the api
+// responded with a Retry-After header
+func (l *RateLimiter) Pause(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if until := time.Now().Add(d); until.After(l.pausedUntil) {
+		l.pausedUntil = until
+	}
+}
+
+// reserve registers the request and returns zero if it fits, or otherwise
+// returns how long to wait before trying again
+func (l *RateLimiter) reserve(tokens int) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if now.Before(l.pausedUntil) {
+		return l.pausedUntil.Sub(now)
+	}
+
+	start := now.Add(-time.Minute)
+	for len(l.window) > 0 && !l.window[0].at.After(start) {
+		l.window = l.window[1:]
+	}
+	sum := 0
+	for _, e := range l.window {
+		sum += e.tokens
+	}
+
+	tooManyRequests := l.requestsPerMinute > 0 && len(l.window) >= l.requestsPerMinute
+	// a single request that is larger than the budget is allowed when nothing
+	// else is in the window, otherwise it would wait forever
+	tooManyTokens := l.tokensPerMinute > 0 && len(l.window) > 0 && sum+tokens > l.tokensPerMinute
+	if tooManyRequests || tooManyTokens {
+		if wait := l.window[0].at.Add(time.Minute).Sub(now); wait > 0 {
+			return wait
+		}
+		return time.Millisecond
+	}
+
+	l.window = append(l.window, limitEntry{at: now, tokens: tokens})
+	return 0
+}
+
+type tokensKey struct{}
+
+// withTokens stores the number of tokens of a request in the context, so that
+// the transport can charge a retry the same as the first attempt
+func withTokens(ctx context.Context, tokens int) context.Context {
+	return context.WithValue(ctx, tokensKey{}, tokens)
+}
+
+func tokensFrom(ctx context.Context) int {
+	tokens, _ := ctx.Value(tokensKey{}).(int)
+	return tokens
+}
+
+// Transport returns an http.RoundTripper that retries requests that were
+// rejected with status 429. It pauses the limiter for the time in the
+// Retry-After header, or with an exponential backoff if there is none. A 429
+// because the quota of the account is used up is returned right away, as
+// retrying will not help.
+func (l *RateLimiter) Transport(base http.RoundTripper, maxRetries int) http.RoundTripper {
+	return &retryTransport{
+		base:       base,
+		limiter:    l,
+		maxRetries: maxRetries,
+	}
+}
+
+type retryTransport struct {
+	base       http.RoundTripper
+	limiter    *RateLimiter
+	maxRetries int
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		try := req
+		if attempt > 0 {
+			if err := t.limiter.Wait(req.Context(), tokensFrom(req.Context())); err != nil {
+				return nil, err
+			}
+			try = req.Clone(req.Context())
+			if req.GetBody != nil {
+				body, err := req.GetBody()
+				if err != nil {
+					return nil, err
+				}
+				try.Body = body
+			}
+		}
+
+		resp, err := t.base.RoundTrip(try)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusTooManyRequests || attempt >= t.maxRetries || (req.Body != nil && req.GetBody == nil) {
+			return resp, nil
+		}
+		quota, err := insufficientQuota(resp)
+		if err != nil {
+			return nil, err
+		}
+		if quota {
+			return resp, nil
+		}
+
+		resp.Body.Close()
+		t.limiter.Pause(retryAfter(resp.Header.Get("Retry-After"), attempt))
+	}
+}
+
+// insufficientQuota reports whether the api rejected the request because the
+// account has no quota left. The body is read and replaced, so the caller can
+// still read the error.
+func insufficientQuota(resp *http.Response) (bool, error) {
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return false, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	var errResp struct {
+		Error struct {
+			Code string `json:"code"`
+			Type string `json:"type"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(body, &errResp); err != nil {
+		return false, nil
+	}
+
+	return errResp.Error.Code == "insufficient_quota" || errResp.Error.Type == "insufficient_quota", nil
+}
+
+// retryAfter parses the Retry-After header, which is either a number of
+// seconds or a date
+func retryAfter(header string, attempt int) time.Duration {
+	if seconds, err := strconv.Atoi(header); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(header); err == nil {
+		if wait := time.Until(date); wait > 0 {
+			return wait
+		}
+		return 0
+	}
+
+	return time.Duration(math.Pow(2, float64(attempt))) * time.Second
+}
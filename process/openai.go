@@ -2,53 +2,230 @@ package process
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"strings"
 
 	"go-mod.ewintr.nl/yogai/model"
 	"github.com/sashabaranov/go-openai"
 )
 
+const (
+	// completionReserve is the number of tokens in the context window that
+	// are kept free for the answer
+	completionReserve = 1024
+	// maxReduceDepth limits how often partial summaries can be summarized
+	// again when they still do not fit in the context window
+	maxReduceDepth = 3
+)
+
+var (
+	ErrNoChoices       = errors.New("response contains no choices")
+	ErrEmptyResponse   = errors.New("response is empty")
+	ErrContentFiltered = errors.New("response was filtered")
+	ErrPromptTooLong   = errors.New("prompt does not fit in context window")
+)
+
 type OpenAISummarizer struct {
-	client *openai.Client
+	client    *openai.Client
+	model     string
+	tokenizer *Tokenizer
+	limiter   *RateLimiter
+	prompt    *Prompt
 }
 
-func NewOpenAISummarizer(client *openai.Client) *OpenAISummarizer {
-	return &OpenAISummarizer{
-		client: client,
+func NewOpenAISummarizer(client *openai.Client, limiter *RateLimiter, prompt *Prompt) (*OpenAISummarizer, error) {
+	tokenizer, err := NewTokenizer(openai.GPT4)
+	if err != nil {
+		return nil, err
 	}
+
+	return &OpenAISummarizer{
+		client:    client,
+		model:     openai.GPT4,
+		tokenizer: tokenizer,
+		limiter:   limiter,
+		prompt:    prompt,
+	}, nil
 }
 
 func (sum *OpenAISummarizer) Name() string {
 	return "openai summarizer"
 }
 
-func (sum *OpenAISummarizer) Do(ctx context.Context, video *model.Video) error {
-	const summarizePrompt = `You are an helpful assistant. Your task is to extract all text that refers to the content of a yoga workout video from the description a user gives you.
-You will not add introductory sentences like "This text is about", or "Summary of...". Just give the words verbatim. Trim any white space back to a simple space
-`
+func (sum *OpenAISummarizer) Version() string {
+	return sum.prompt.Version
+}
+
+func (sum *OpenAISummarizer) Model() string {
+	return sum.model
+}
+
+// Input is the complete prompt for the video
+func (sum *OpenAISummarizer) Input(video *model.Video) (string, error) {
+	msgs, err := sum.messages(NewPromptData(video))
+	if err != nil {
+		return "", err
+	}
+	var input strings.Builder
+	for _, msg := range msgs {
+		fmt.Fprintf(&input, "%s\n%s\n", msg.Role, msg.Content)
+	}
+
+	return input.String(), nil
+}
+
+type summaryOutput struct {
+	Summary      string `json:"summary"`
+	FinishReason string `json:"finish_reason"`
+}
+
+func (sum *OpenAISummarizer) Output(video *model.Video) ([]byte, error) {
+	return json.Marshal(summaryOutput{
+		Summary:      video.Summary,
+		FinishReason: video.SummaryFinishReason,
+	})
+}
+
+func (sum *OpenAISummarizer) Restore(video *model.Video, output []byte) error {
+	var out summaryOutput
+	if err := json.Unmarshal(output, &out); err != nil {
+		return err
+	}
+	video.Summary = out.Summary
+	video.SummaryVersion = sum.prompt.Version
+	video.SummaryFinishReason = out.FinishReason
+
+	return nil
+}
+
+func (sum *OpenAISummarizer) Do(ctx context.Context, video *model.Video) (Usage, error) {
+	usage := Usage{Model: sum.model}
+	summary, finishReason, err := sum.summarize(ctx, NewPromptData(video), 0, &usage)
+	if err != nil {
+		return usage, fmt.Errorf("failed to fetch summary: %w", err)
+	}
+
+	video.Summary = summary
+	video.SummaryVersion = sum.prompt.Version
+	video.SummaryFinishReason = finishReason
+
+	return usage, nil
+}
+
+// summarize sends the prompt in one request if it fits in the context window.
+// If not, the description is split in chunks that are summarized separately,
+// after which the combined partial summaries are summarized again.
+func (sum *OpenAISummarizer) summarize(ctx context.Context, data PromptData, depth int, usage *Usage) (string, string, error) {
+	msgs, err := sum.messages(data)
+	if err != nil {
+		return "", "", err
+	}
+	available := sum.tokenizer.Window() - completionReserve
+	if sum.tokenizer.CountMessages(msgs) <= available {
+		return sum.complete(ctx, msgs, usage)
+	}
+	if depth >= maxReduceDepth {
+		return "", "", ErrPromptTooLong
+	}
+
+	// map
+	empty := data
+	empty.Description = ""
+	emptyMsgs, err := sum.messages(empty)
+	if err != nil {
+		return "", "", err
+	}
+	chunkSize := available - sum.tokenizer.CountMessages(emptyMsgs)
+	if chunkSize <= 0 {
+		return "", "", ErrPromptTooLong
+	}
+	chunks := sum.tokenizer.Split(data.Description, chunkSize)
+	if len(chunks) < 2 {
+		return "", "", ErrPromptTooLong
+	}
+	parts := make([]string, 0, len(chunks))
+	for _, chunk := range chunks {
+		part := data
+		part.Description = chunk
+		partMsgs, err := sum.messages(part)
+		if err != nil {
+			return "", "", err
+		}
+		summary, _, err := sum.complete(ctx, partMsgs, usage)
+		if err != nil {
+			return "", "", err
+		}
+		parts = append(parts, summary)
+	}
+
+	// reduce
+	reduced := data
+	reduced.Description = strings.Join(parts, "\n\n")
+
+	return sum.summarize(ctx, reduced, depth+1, usage)
+}
+
+func (sum *OpenAISummarizer) messages(data PromptData) ([]openai.ChatCompletionMessage, error) {
+	return chatMessages(sum.prompt, data)
+}
+
+// chatMessages renders the system and user templates of the prompt
+func chatMessages(prompt *Prompt, data PromptData) ([]openai.ChatCompletionMessage, error) {
+	system, err := prompt.System(data)
+	if err != nil {
+		return nil, err
+	}
+	user, err := prompt.User(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return []openai.ChatCompletionMessage{
+		{
+			Role:    openai.ChatMessageRoleSystem,
+			Content: system,
+		},
+
+		{
+			Role:    openai.ChatMessageRoleUser,
+			Content: user,
+		},
+	}, nil
+}
+
+// complete returns the content and the finish reason of the answer and adds
+// the tokens of the request to usage
+func (sum *OpenAISummarizer) complete(ctx context.Context, msgs []openai.ChatCompletionMessage, usage *Usage) (string, string, error) {
+	tokens := sum.tokenizer.CountMessages(msgs) + completionReserve
+	ctx = withTokens(ctx, tokens)
+	if err := sum.limiter.Wait(ctx, tokens); err != nil {
+		return "", "", err
+	}
 
 	resp, err := sum.client.CreateChatCompletion(
 		ctx,
 		openai.ChatCompletionRequest{
-			Model: openai.GPT4,
-			Messages: []openai.ChatCompletionMessage{
-				{
-					Role:    openai.ChatMessageRoleSystem,
-					Content: summarizePrompt,
-				},
-
-				{
-					Role:    openai.ChatMessageRoleUser,
-					Content: fmt.Sprintf("%s\n\n%s", video.YoutubeTitle, video.YoutubeDescription),
-				},
-			},
+			Model:    sum.model,
+			Messages: msgs,
 		})
-
 	if err != nil {
-		return fmt.Errorf("failed to fetch summary: %w", err)
+		return "", "", err
 	}
+	usage.Add(sum.model, resp.Usage)
 
-	video.Summary = resp.Choices[len(resp.Choices)-1].Message.Content
+	if len(resp.Choices) == 0 {
+		return "", "", ErrNoChoices
+	}
+	choice := resp.Choices[0]
+	if choice.FinishReason == "content_filter" {
+		return "", choice.FinishReason, ErrContentFiltered
+	}
+	content := strings.TrimSpace(choice.Message.Content)
+	if content == "" {
+		return "", choice.FinishReason, ErrEmptyResponse
+	}
 
-	return nil
+	return content, choice.FinishReason, nil
 }
@@ -2,88 +2,345 @@ package process
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
 
+	"go-mod.ewintr.nl/yogai/metrics"
 	"go-mod.ewintr.nl/yogai/model"
 	"go-mod.ewintr.nl/yogai/storage"
+	"go-mod.ewintr.nl/yogai/tracing"
 	"github.com/sashabaranov/go-openai"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/exp/slog"
 )
 
+var tracer = otel.Tracer("go-mod.ewintr.nl/yogai/process")
+
 type VideoProcessor interface {
 	Name() string
-	Do(ctx context.Context, video *model.Video) error
+	Do(ctx context.Context, video *model.Video) (Usage, error)
 }
 
 type Processors struct {
-	procs map[string]VideoProcessor
+	classifier    *OpenAIClassifier
+	summarizer    *OpenAISummarizer
+	procs         map[string]VideoProcessor
+	minConfidence float64
 }
 
-func NewProcessors(openAIClient *openai.Client) *Processors {
-	return &Processors{
+// NewProcessors creates the processors. When cacheRepo is not nil, the
+// processors that call an LLM use it to store and reuse their output. Videos
+// that the classifier does not see as a practice are only skipped when it is
+// at least minConfidence sure.
+func NewProcessors(openAIClient *openai.Client, limiter *RateLimiter, prompts *Prompts, cacheRepo storage.LLMCacheRepository, minConfidence float64, logger *slog.Logger) (*Processors, error) {
+	classifyPrompt, err := prompts.Load("classifier")
+	if err != nil {
+		return nil, err
+	}
+	classifier, err := NewOpenAIClassifier(openAIClient, limiter, classifyPrompt)
+	if err != nil {
+		return nil, err
+	}
+	summarizePrompt, err := prompts.Load("summarizer")
+	if err != nil {
+		return nil, err
+	}
+	summarizer, err := NewOpenAISummarizer(openAIClient, limiter, summarizePrompt)
+	if err != nil {
+		return nil, err
+	}
+
+	procs := &Processors{
+		classifier: classifier,
+		summarizer: summarizer,
 		procs: map[string]VideoProcessor{
-			"summarizer": NewOpenAISummarizer(openAIClient),
+			"classifier": classifier,
+			"summarizer": summarizer,
 		},
+		minConfidence: minConfidence,
+	}
+	if cacheRepo != nil {
+		procs.procs["classifier"] = NewCachedProcessor(classifier, cacheRepo, logger)
+		procs.procs["summarizer"] = NewCachedProcessor(summarizer, cacheRepo, logger)
+	}
+
+	return procs, nil
+}
+
+// SummaryVersion is the version of the prompt that is currently used for summaries
+func (p *Processors) SummaryVersion() string {
+	return p.summarizer.Version()
+}
+
+// Names returns the keys of all processors
+func (p *Processors) Names() []string {
+	names := make([]string, 0, len(p.procs))
+	for name := range p.procs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Reset clears the output of the named processors on the video, so that Next
+// will return them again. Without names, all processors are reset. A
+// classification that was overridden is kept.
+func (p *Processors) Reset(video *model.Video, names ...string) error {
+	if len(names) == 0 {
+		names = p.Names()
+	}
+	for _, name := range names {
+		switch name {
+		case "classifier":
+			if video.ClassificationOverridden {
+				continue
+			}
+			video.Classification = ""
+			video.ClassificationConfidence = 0
+			video.ClassificationVersion = ""
+		case "summarizer":
+			video.Summary = ""
+			video.SummaryVersion = ""
+			video.SummaryFinishReason = ""
+		default:
+			return fmt.Errorf("unknown processor %q", name)
+		}
 	}
+
+	return nil
 }
 
 func (p *Processors) Next(video *model.Video) VideoProcessor {
-	if video.Summary == "" {
+	if !video.ClassificationOverridden && (video.Classification == "" || video.ClassificationVersion != p.classifier.Version()) {
+		return p.procs["classifier"]
+	}
+	if video.Summary == "" || video.SummaryVersion != p.summarizer.Version() {
 		return p.procs["summarizer"]
 	}
 
 	return nil
 }
 
+// SkipReason tells why the video should not be processed further, or returns
+// an empty string if it should
+func (p *Processors) SkipReason(video *model.Video) string {
+	if video.Classification != model.ClassificationOther {
+		return ""
+	}
+	if video.ClassificationOverridden {
+		return "classification overridden as not a practice"
+	}
+	if video.ClassificationConfidence < p.minConfidence {
+		return ""
+	}
+
+	return fmt.Sprintf("classified as not a practice with confidence %.2f", video.ClassificationConfidence)
+}
+
+const processVisibility = 15 * time.Minute
+
 type Pipeline struct {
-	in         chan *model.Video
-	procs      *Processors
-	logger     *slog.Logger
-	relStorage storage.VideoRelRepository
-	vecStorage storage.VideoVecRepository
+	queue        storage.JobQueue
+	pollInterval time.Duration
+	procs        *Processors
+	logger       *slog.Logger
+	relStorage   storage.VideoRelRepository
+	eventRepo    storage.VideoEventRepository
+	vecStorage   storage.VideoVecRepository
+	usageRepo    storage.UsageRepository
+	budget       *Budget
 }
 
-func NewPipeline(in chan *model.Video, processors *Processors, relDB storage.VideoRelRepository, vecDB storage.VideoVecRepository, logger *slog.Logger) *Pipeline {
+func NewPipeline(queue storage.JobQueue, processors *Processors, relDB storage.VideoRelRepository, eventRepo storage.VideoEventRepository, vecDB storage.VideoVecRepository, usageRepo storage.UsageRepository, budget *Budget, logger *slog.Logger) *Pipeline {
 	return &Pipeline{
-		in:         in,
-		procs:      processors,
-		relStorage: relDB,
-		vecStorage: vecDB,
-		logger:     logger,
+		queue:        queue,
+		pollInterval: 10 * time.Second,
+		procs:        processors,
+		relStorage:   relDB,
+		eventRepo:    eventRepo,
+		vecStorage:   vecDB,
+		usageRepo:    usageRepo,
+		budget:       budget,
+		logger:       logger,
 	}
 }
 
 func (p *Pipeline) Run() {
 	ctx := context.Background()
-	for video := range p.in {
-		p.Process(ctx, video)
+	for {
+		if err := p.budget.Wait(ctx); err != nil {
+			p.logger.Error("failed to check budget", slog.String("error", err.Error()))
+			time.Sleep(p.pollInterval)
+			continue
+		}
+
+		jobs, err := p.queue.Lease(model.QueueProcess, 1, processVisibility)
+		if err != nil {
+			p.logger.Error("failed to lease process job", slog.String("error", err.Error()))
+		}
+		if len(jobs) == 0 {
+			time.Sleep(p.pollInterval)
+			continue
+		}
+
+		job := jobs[0]
+		video, err := p.relStorage.FindByID(job.SubjectID)
+		if err == nil && (video.Status == model.StatusUnavailable || video.Status == model.StatusSkipped) {
+			// changed after it was queued
+			p.logger.Info("skipping video", slog.String("video", string(video.YoutubeID)), slog.String("status", string(video.Status)))
+			if err := p.queue.Ack(job); err != nil {
+				p.logger.Error("failed to ack job", slog.String("error", err.Error()))
+			}
+			continue
+		}
+		if err == nil {
+			err = p.Process(ctx, video)
+		}
+		if errors.Is(err, storage.ErrConflict) {
+			// reset or changed by someone else, the ack releases the job
+			// again if the video was queued anew
+			p.logger.Info("video changed while processing", slog.String("video", string(video.YoutubeID)))
+			if err := p.queue.Ack(job); err != nil {
+				p.logger.Error("failed to ack job", slog.String("error", err.Error()))
+			}
+			continue
+		}
+		if err != nil {
+			p.logger.Error("failed to process video", slog.String("id", job.SubjectID.String()), slog.Int("attempts", job.Attempts), slog.String("error", err.Error()))
+			if job.Exhausted() {
+				p.logger.Warn("giving up on video", slog.String("id", job.SubjectID.String()))
+			}
+			if err := p.queue.Nack(job, err, job.Backoff()); err != nil {
+				p.logger.Error("failed to nack job", slog.String("error", err.Error()))
+			}
+			continue
+		}
+		if err := p.queue.Ack(job); err != nil {
+			p.logger.Error("failed to ack job", slog.String("error", err.Error()))
+		}
 	}
 }
 
-func (p *Pipeline) Process(ctx context.Context, video *model.Video) {
+func (p *Pipeline) Process(ctx context.Context, video *model.Video) (err error) {
 	p.logger.Info("processing video", slog.String("video", string(video.YoutubeID)))
+	ctx, span := tracer.Start(ctx, "process.video", tracing.Video(video.ID))
+	defer func() { tracing.End(span, err) }()
+
 	for {
+		if reason := p.procs.SkipReason(video); reason != "" {
+			return p.skip(ctx, video, reason)
+		}
+
 		next := p.procs.Next(video)
 		if next == nil {
 			p.logger.Info("no more processors for video", slog.String("video", string(video.YoutubeID)))
+			previous := video.Status
 			video.Status = model.StatusReady
-			if err := p.relStorage.Save(video); err != nil {
-				p.logger.Error("failed to save video in rel db", slog.String("video", string(video.YoutubeID)), slog.String("error", err.Error()))
+			if err := p.saveRel(ctx, video); err != nil {
+				return fmt.Errorf("failed to save video in rel db: %w", err)
 			}
-			return
+			if previous != video.Status {
+				p.addEvent(model.NewStatusEvent(video, previous, "pipeline"))
+			}
+			return nil
 		}
 
 		p.logger.Info("processing video", slog.String("video", string(video.YoutubeID)), slog.String("processor", next.Name()))
-		if err := next.Do(context.Background(), video); err != nil {
-			p.logger.Error("failed to process video", slog.String("video", string(video.YoutubeID)), slog.String("processor", next.Name()), slog.String("error", err.Error()))
-			return
+		if err := p.run(ctx, next, video); err != nil {
+			return fmt.Errorf("processor %s failed: %w", next.Name(), err)
+		}
+		// checked before the save to the vec db, so that videos that are not
+		// a practice are never embedded
+		if reason := p.procs.SkipReason(video); reason != "" {
+			return p.skip(ctx, video, reason)
 		}
-		if err := p.relStorage.Save(video); err != nil {
-			p.logger.Error("failed to save video in rel db", slog.String("video", string(video.YoutubeID)), slog.String("error", err.Error()))
-			return
+		if err := p.saveRel(ctx, video); err != nil {
+			return fmt.Errorf("failed to save video in rel db: %w", err)
 		}
-		if err := p.vecStorage.Save(ctx, video); err != nil {
-			p.logger.Error("failed to save video in rel db", slog.String("video", string(video.YoutubeID)), slog.String("error", err.Error()))
-			return
+		if err := p.saveVec(ctx, video); err != nil {
+			return fmt.Errorf("failed to save video in vec db: %w", err)
 		}
 	}
 }
+
+// skip marks the video as skipped and removes it from the vec db, it may have
+// been saved there before it was classified again, e.g. after a reprocess
+func (p *Pipeline) skip(ctx context.Context, video *model.Video, reason string) error {
+	p.logger.Info("skipping video", slog.String("video", string(video.YoutubeID)), slog.String("reason", reason))
+	previous := video.Status
+	video.Status = model.StatusSkipped
+	video.SkipReason = reason
+	if err := p.saveRel(ctx, video); err != nil {
+		return fmt.Errorf("failed to save video in rel db: %w", err)
+	}
+	if err := p.vecStorage.Delete(ctx, video); err != nil {
+		return fmt.Errorf("failed to delete video from vec db: %w", err)
+	}
+	if previous != video.Status {
+		p.addEvent(model.NewStatusEvent(video, previous, "pipeline"))
+	}
+
+	return nil
+}
+
+func (p *Pipeline) run(ctx context.Context, proc VideoProcessor, video *model.Video) error {
+	ctx, span := tracer.Start(ctx, "process.processor", tracing.Video(video.ID), trace.WithAttributes(attribute.String("yogai.processor", proc.Name())))
+	start := time.Now()
+	usage, err := proc.Do(ctx, video)
+	metrics.ProcessorDuration.WithLabelValues(proc.Name()).Observe(time.Since(start).Seconds())
+	p.saveUsage(video, proc.Name(), usage, time.Since(start))
+	p.addEvent(model.NewProcessorEvent(video, proc.Name(), err, "pipeline"))
+	if err != nil {
+		metrics.ProcessorFailures.WithLabelValues(proc.Name()).Inc()
+	}
+	span.SetAttributes(attribute.Int("yogai.prompt_tokens", usage.PromptTokens), attribute.Int("yogai.completion_tokens", usage.CompletionTokens))
+	tracing.End(span, err)
+
+	return err
+}
+
+func (p *Pipeline) saveRel(ctx context.Context, video *model.Video) error {
+	_, span := tracer.Start(ctx, "process.rel_save", tracing.Video(video.ID))
+	err := p.relStorage.Save(video)
+	tracing.End(span, err)
+
+	return err
+}
+
+func (p *Pipeline) saveVec(ctx context.Context, video *model.Video) error {
+	ctx, span := tracer.Start(ctx, "process.vec_save", tracing.Video(video.ID))
+	err := p.vecStorage.Save(ctx, video)
+	tracing.End(span, err)
+
+	return err
+}
+
+func (p *Pipeline) saveUsage(video *model.Video, processor string, usage Usage, latency time.Duration) {
+	if usage.PromptTokens == 0 && usage.CompletionTokens == 0 {
+		return
+	}
+
+	if err := p.usageRepo.Save(&model.LLMUsage{
+		VideoID:          video.ID,
+		Processor:        processor,
+		Model:            usage.Model,
+		PromptTokens:     usage.PromptTokens,
+		CompletionTokens: usage.CompletionTokens,
+		Latency:          latency,
+		Cost:             usage.Cost(),
+		CreatedAt:        time.Now(),
+	}); err != nil {
+		p.logger.Error("failed to save usage", slog.String("video", string(video.YoutubeID)), slog.String("processor", processor), slog.String("error", err.Error()))
+	}
+}
+
+func (p *Pipeline) addEvent(event *model.VideoEvent) {
+	if err := p.eventRepo.Add(event); err != nil {
+		p.logger.Error("failed to add video event", slog.String("id", event.VideoID.String()), slog.String("error", err.Error()))
+	}
+}
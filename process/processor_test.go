@@ -0,0 +1,151 @@
+package process
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"go-mod.ewintr.nl/yogai/model"
+	"go-mod.ewintr.nl/yogai/storage"
+	"github.com/google/uuid"
+	"golang.org/x/exp/slog"
+)
+
+// fakeProcessor runs do and records that it was called
+type fakeProcessor struct {
+	name   string
+	do     func(video *model.Video)
+	called int
+}
+
+func (f *fakeProcessor) Name() string { return f.name }
+
+func (f *fakeProcessor) Do(_ context.Context, video *model.Video) (Usage, error) {
+	f.called++
+	f.do(video)
+
+	return Usage{}, nil
+}
+
+type memRelRepo struct {
+	storage.VideoRelRepository
+	saved []model.VideoStatus
+}
+
+func (r *memRelRepo) Save(video *model.Video) error {
+	r.saved = append(r.saved, video.Status)
+	return nil
+}
+
+type memEventRepo struct {
+	storage.VideoEventRepository
+}
+
+func (r *memEventRepo) Add(_ *model.VideoEvent) error { return nil }
+
+type memVecRepo struct {
+	saved   int
+	deleted int
+}
+
+func (r *memVecRepo) Save(_ context.Context, _ *model.Video) error {
+	r.saved++
+	return nil
+}
+
+func (r *memVecRepo) Delete(_ context.Context, _ *model.Video) error {
+	r.deleted++
+	return nil
+}
+
+func TestPipelineProcess(t *testing.T) {
+	for _, tc := range []struct {
+		name           string
+		video          model.Video
+		classification model.Classification
+		confidence     float64
+		expStatus      model.VideoStatus
+		expClassified  int
+		expSummarized  int
+		expVecSaved    int
+		expVecDeleted  int
+	}{
+		{
+			name:           "practice",
+			classification: model.ClassificationPractice,
+			confidence:     0.9,
+			expStatus:      model.StatusReady,
+			expClassified:  1,
+			expSummarized:  1,
+			expVecSaved:    2,
+		},
+		{
+			name:           "not a practice",
+			classification: model.ClassificationOther,
+			confidence:     0.9,
+			expStatus:      model.StatusSkipped,
+			expClassified:  1,
+			expVecDeleted:  1,
+		},
+		{
+			name:           "not sure enough",
+			classification: model.ClassificationOther,
+			confidence:     0.5,
+			expStatus:      model.StatusReady,
+			expClassified:  1,
+			expSummarized:  1,
+			expVecSaved:    2,
+		},
+		{
+			name:          "overridden",
+			video:         model.Video{Classification: model.ClassificationOther, ClassificationOverridden: true},
+			expStatus:     model.StatusSkipped,
+			expVecDeleted: 1,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			classifier := &fakeProcessor{name: "classifier", do: func(video *model.Video) {
+				video.Classification = tc.classification
+				video.ClassificationConfidence = tc.confidence
+				video.ClassificationVersion = "c1"
+			}}
+			summarizer := &fakeProcessor{name: "summarizer", do: func(video *model.Video) {
+				video.Summary = "a summary"
+				video.SummaryVersion = "s1"
+			}}
+			procs := &Processors{
+				classifier:    &OpenAIClassifier{prompt: &Prompt{Version: "c1"}},
+				summarizer:    &OpenAISummarizer{prompt: &Prompt{Version: "s1"}},
+				procs:         map[string]VideoProcessor{"classifier": classifier, "summarizer": summarizer},
+				minConfidence: 0.7,
+			}
+			relRepo, vecRepo := &memRelRepo{}, &memVecRepo{}
+			pipeline := NewPipeline(nil, procs, relRepo, &memEventRepo{}, vecRepo, nil, nil, slog.New(slog.NewTextHandler(io.Discard)))
+
+			video := tc.video
+			video.ID = uuid.New()
+			video.Status = model.StatusFetched
+			if err := pipeline.Process(context.Background(), &video); err != nil {
+				t.Fatalf("exp nil, got %v", err)
+			}
+			if video.Status != tc.expStatus {
+				t.Errorf("exp status %s, got %s", tc.expStatus, video.Status)
+			}
+			if last := relRepo.saved[len(relRepo.saved)-1]; last != tc.expStatus {
+				t.Errorf("exp saved status %s, got %s", tc.expStatus, last)
+			}
+			if classifier.called != tc.expClassified {
+				t.Errorf("exp classifier called %d times, got %d", tc.expClassified, classifier.called)
+			}
+			if summarizer.called != tc.expSummarized {
+				t.Errorf("exp summarizer called %d times, got %d", tc.expSummarized, summarizer.called)
+			}
+			if vecRepo.saved != tc.expVecSaved {
+				t.Errorf("exp %d saves in vec db, got %d", tc.expVecSaved, vecRepo.saved)
+			}
+			if vecRepo.deleted != tc.expVecDeleted {
+				t.Errorf("exp %d deletes from vec db, got %d", tc.expVecDeleted, vecRepo.deleted)
+			}
+		})
+	}
+}
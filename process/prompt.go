@@ -0,0 +1,101 @@
+package process
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+	"text/template"
+
+	"go-mod.ewintr.nl/yogai/model"
+)
+
+//go:embed prompts/*.tmpl
+var defaultPrompts embed.FS
+
+// PromptData holds the variables that are available in a prompt template
+type PromptData struct {
+	Title       string
+	Description string
+	// Transcript is empty for now, captions are not downloaded from YouTube
+	Transcript string
+	Channel    string
+}
+
+func NewPromptData(video *model.Video) PromptData {
+	return PromptData{
+		Title:       video.YoutubeTitle,
+		Description: video.YoutubeDescription,
+		Channel:     string(video.YoutubeChannelID),
+	}
+}
+
+// Prompt is a versioned template for a chat completion. The template file
+// must define the templates "version", "system" and "user".
+type Prompt struct {
+	Name    string
+	Version string
+	tmpl    *template.Template
+}
+
+// Prompts loads prompt templates from dir, or from the embedded defaults if
+// dir is empty. The prompts directory also keeps queries.txt, a list of
+// example user queries to try the prompts against.
+type Prompts struct {
+	files fs.FS
+}
+
+func NewPrompts(dir string) *Prompts {
+	if dir == "" {
+		sub, _ := fs.Sub(defaultPrompts, "prompts")
+		return &Prompts{files: sub}
+	}
+
+	return &Prompts{files: os.DirFS(dir)}
+}
+
+func (p *Prompts) Load(name string) (*Prompt, error) {
+	tmpl, err := template.ParseFS(p.files, fmt.Sprintf("%s.tmpl", name))
+	if err != nil {
+		return nil, fmt.Errorf("could not parse prompt %s: %w", name, err)
+	}
+	for _, def := range []string{"version", "system", "user"} {
+		if tmpl.Lookup(def) == nil {
+			return nil, fmt.Errorf("prompt %s does not define %q", name, def)
+		}
+	}
+
+	var version bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&version, "version", nil); err != nil {
+		return nil, fmt.Errorf("could not read version of prompt %s: %w", name, err)
+	}
+	v := strings.TrimSpace(version.String())
+	if v == "" {
+		return nil, fmt.Errorf("prompt %s has an empty version", name)
+	}
+
+	return &Prompt{
+		Name:    name,
+		Version: v,
+		tmpl:    tmpl,
+	}, nil
+}
+
+func (p *Prompt) System(data PromptData) (string, error) {
+	return p.execute("system", data)
+}
+
+func (p *Prompt) User(data PromptData) (string, error) {
+	return p.execute("user", data)
+}
+
+func (p *Prompt) execute(name string, data PromptData) (string, error) {
+	var buf bytes.Buffer
+	if err := p.tmpl.ExecuteTemplate(&buf, name, data); err != nil {
+		return "", fmt.Errorf("could not execute %s template of prompt %s: %w", name, p.Name, err)
+	}
+
+	return buf.String(), nil
+}
@@ -0,0 +1,106 @@
+package process
+
+import (
+	"errors"
+	"fmt"
+
+	"go-mod.ewintr.nl/yogai/model"
+	"go-mod.ewintr.nl/yogai/storage"
+)
+
+// StepMetadata can be passed to Reprocess next to the processor names to
+// fetch the metadata of the videos again before processing
+const StepMetadata = "metadata"
+
+// Reprocessor resets videos and puts them back in the queues at runtime
+type Reprocessor struct {
+	procs     *Processors
+	videoRepo storage.VideoRelRepository
+	eventRepo storage.VideoEventRepository
+	queue     storage.JobQueue
+}
+
+func NewReprocessor(procs *Processors, videoRepo storage.VideoRelRepository, eventRepo storage.VideoEventRepository, queue storage.JobQueue) *Reprocessor {
+	return &Reprocessor{
+		procs:     procs,
+		videoRepo: videoRepo,
+		eventRepo: eventRepo,
+		queue:     queue,
+	}
+}
+
+// Validate checks whether all steps are known processors or StepMetadata
+func (r *Reprocessor) Validate(steps []string) error {
+	known := map[string]bool{StepMetadata: true}
+	for _, name := range r.procs.Names() {
+		known[name] = true
+	}
+	for _, step := range steps {
+		if !known[step] {
+			return fmt.Errorf("unknown processor %q", step)
+		}
+	}
+
+	return nil
+}
+
+// Reprocess resets the output of the given steps, or of all processors when
+// there are none, and queues the videos. Videos that need new metadata go
+// back to status new, the others to fetched. Unavailable and skipped videos
+// always need new metadata, so that the checks run again. Videos that were
+// changed since they were read are left alone and reported with a
+// storage.ErrConflict after the others are queued. A pipeline run that is
+// still going on for a video that was reset fails on its next save instead.
+func (r *Reprocessor) Reprocess(videos []*model.Video, steps []string, actor string) error {
+	if err := r.Validate(steps); err != nil {
+		return err
+	}
+	metadata := false
+	procs := []string{}
+	for _, step := range steps {
+		if step == StepMetadata {
+			metadata = true
+			continue
+		}
+		procs = append(procs, step)
+	}
+	if metadata && len(procs) == 0 {
+		// new metadata means new input for all processors
+		procs = r.procs.Names()
+	}
+
+	conflicts := 0
+	for _, video := range videos {
+		if err := r.procs.Reset(video, procs...); err != nil {
+			return err
+		}
+		previous := video.Status
+		queue := model.QueueProcess
+		video.Status = model.StatusFetched
+		if metadata || previous == model.StatusNew || previous == model.StatusUnavailable || previous == model.StatusSkipped {
+			queue = model.QueueMetadata
+			video.Status = model.StatusNew
+		}
+		err := r.videoRepo.Save(video)
+		if errors.Is(err, storage.ErrConflict) {
+			conflicts++
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if previous != video.Status {
+			if err := r.eventRepo.Add(model.NewStatusEvent(video, previous, actor)); err != nil {
+				return err
+			}
+		}
+		if err := r.queue.Enqueue(queue, video.ID, model.PriorityHigh); err != nil {
+			return err
+		}
+	}
+	if conflicts > 0 {
+		return fmt.Errorf("%d of %d videos were changed while resetting: %w", conflicts, len(videos), storage.ErrConflict)
+	}
+
+	return nil
+}
@@ -0,0 +1,123 @@
+package process
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pkoukk/tiktoken-go"
+	tiktokenloader "github.com/pkoukk/tiktoken-go-loader"
+	"github.com/sashabaranov/go-openai"
+)
+
+func init() {
+	// use the embedded encodings instead of downloading them on first use
+	tiktoken.SetBpeLoader(tiktokenloader.NewOfflineLoader())
+}
+
+// contextWindows holds the maximum number of tokens, prompt and completion
+// combined, that a model can handle
+var contextWindows = map[string]int{
+	openai.GPT4:              8192,
+	openai.GPT40314:          8192,
+	openai.GPT432K:           32768,
+	openai.GPT432K0314:       32768,
+	openai.GPT3Dot5Turbo:     4096,
+	openai.GPT3Dot5Turbo0301: 4096,
+}
+
+type Tokenizer struct {
+	model    string
+	window   int
+	encoding *tiktoken.Tiktoken
+}
+
+func NewTokenizer(model string) (*Tokenizer, error) {
+	window, ok := contextWindows[model]
+	if !ok {
+		return nil, fmt.Errorf("unknown context window for model %s", model)
+	}
+	enc, err := tiktoken.EncodingForModel(model)
+	if err != nil {
+		return nil, fmt.Errorf("could not get encoding for model %s: %w", model, err)
+	}
+
+	return &Tokenizer{
+		model:    model,
+		window:   window,
+		encoding: enc,
+	}, nil
+}
+
+func (t *Tokenizer) Window() int {
+	return t.window
+}
+
+func (t *Tokenizer) Count(text string) int {
+	return len(t.encoding.Encode(text, nil, nil))
+}
+
+// CountMessages returns the number of prompt tokens for a chat request. Every
+// message has some overhead for the role and separators, and the reply is
+// primed with a few tokens as well.
+// See https://github.com/openai/openai-cookbook/blob/main/examples/How_to_count_tokens_with_tiktoken.ipynb
+func (t *Tokenizer) CountMessages(msgs []openai.ChatCompletionMessage) int {
+	count := 3
+	for _, msg := range msgs {
+		count += 3 + t.Count(msg.Role) + t.Count(msg.Content)
+		if msg.Name != "" {
+			count += 1 + t.Count(msg.Name)
+		}
+	}
+
+	return count
+}
+
+// Split cuts text in chunks of at most size tokens. It cuts on line endings
+// where possible and only cuts inside a line when that line alone is too long.
+func (t *Tokenizer) Split(text string, size int) []string {
+	chunks := []string{}
+	current, currentSize := []string{}, 0
+	flush := func() {
+		if len(current) > 0 {
+			chunks = append(chunks, strings.Join(current, "\n"))
+		}
+		current, currentSize = []string{}, 0
+	}
+
+	for _, line := range strings.Split(text, "\n") {
+		tokens := t.encoding.Encode(line, nil, nil)
+		// only lines after the first in a chunk need a separator
+		sep := 0
+		if len(current) > 0 {
+			sep = 1
+		}
+		if currentSize+sep+len(tokens) > size {
+			flush()
+			sep = 0
+		}
+		for len(tokens) > size {
+			n := t.runeBoundary(tokens, size)
+			chunks = append(chunks, t.encoding.Decode(tokens[:n]))
+			tokens = tokens[n:]
+		}
+		current = append(current, t.encoding.Decode(tokens))
+		currentSize += sep + len(tokens)
+	}
+	flush()
+
+	return chunks
+}
+
+// runeBoundary returns the largest n <= size for which tokens[:n] decodes to
+// whole runes. A multi-byte rune can be spread over several tokens and
+// cutting through it would leave invalid UTF-8 on both sides of the cut.
+func (t *Tokenizer) runeBoundary(tokens []int, size int) int {
+	for n := size; n > 1; n-- {
+		if utf8.ValidString(t.encoding.Decode(tokens[:n])) {
+			return n
+		}
+	}
+
+	return 1
+}
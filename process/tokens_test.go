@@ -0,0 +1,106 @@
+package process
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+func TestTokenizerSplit(t *testing.T) {
+	tok, err := NewTokenizer(openai.GPT3Dot5Turbo)
+	if err != nil {
+		t.Fatalf("could not create tokenizer: %v", err)
+	}
+
+	first := "one two three four"
+	second := "five six seven"
+	firstSize, secondSize := tok.Count(first), tok.Count(second)
+
+	for _, tc := range []struct {
+		name string
+		text string
+		size int
+		exp  []string
+	}{
+		{
+			name: "empty",
+			text: "",
+			size: 10,
+			exp:  []string{""},
+		},
+		{
+			name: "single line exact fit",
+			text: first,
+			size: firstSize,
+			exp:  []string{first},
+		},
+		{
+			name: "two lines exact fit",
+			text: first + "\n" + second,
+			size: firstSize + 1 + secondSize,
+			exp:  []string{first + "\n" + second},
+		},
+		{
+			name: "two lines one token short",
+			text: first + "\n" + second,
+			size: firstSize + secondSize,
+			exp:  []string{first, second},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			act := tok.Split(tc.text, tc.size)
+			if len(act) != len(tc.exp) {
+				t.Fatalf("exp %d chunks, got %d: %q", len(tc.exp), len(act), act)
+			}
+			for i := range tc.exp {
+				if act[i] != tc.exp[i] {
+					t.Errorf("chunk %d: exp %q, got %q", i, tc.exp[i], act[i])
+				}
+			}
+		})
+	}
+}
+
+func TestTokenizerSplitOverlong(t *testing.T) {
+	tok, err := NewTokenizer(openai.GPT3Dot5Turbo)
+	if err != nil {
+		t.Fatalf("could not create tokenizer: %v", err)
+	}
+
+	for _, tc := range []struct {
+		name string
+		line string
+		size int
+	}{
+		{
+			name: "ascii",
+			line: strings.Repeat("namaste ", 50),
+			size: 7,
+		},
+		{
+			name: "multi-byte runes",
+			line: strings.Repeat("ヨガの練習 🧘‍♀️ ", 30),
+			size: 5,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			act := tok.Split(tc.line, tc.size)
+			if len(act) < 2 {
+				t.Fatalf("exp line to be cut, got %d chunks", len(act))
+			}
+			for i, chunk := range act {
+				if !utf8.ValidString(chunk) {
+					t.Errorf("chunk %d is not valid utf-8: %q", i, chunk)
+				}
+				if n := len(tok.encoding.Encode(chunk, nil, nil)); n > tc.size {
+					t.Errorf("chunk %d has %d tokens, exp at most %d", i, n, tc.size)
+				}
+			}
+			if joined := strings.Join(act, ""); joined != tc.line {
+				t.Errorf("exp chunks to add up to the line, got %q", joined)
+			}
+		})
+	}
+}
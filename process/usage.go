@@ -0,0 +1,94 @@
+package process
+
+import (
+	"context"
+	"time"
+
+	"go-mod.ewintr.nl/yogai/storage"
+	"github.com/sashabaranov/go-openai"
+	"golang.org/x/exp/slog"
+)
+
+// Usage counts the tokens of all requests that a processor made for a video
+type Usage struct {
+	Model            string
+	PromptTokens     int
+	CompletionTokens int
+}
+
+func (u *Usage) Add(model string, usage openai.Usage) {
+	u.Model = model
+	u.PromptTokens += usage.PromptTokens
+	u.CompletionTokens += usage.CompletionTokens
+}
+
+// price is in dollars per 1000 tokens
+type price struct {
+	prompt     float64
+	completion float64
+}
+
+var prices = map[string]price{
+	openai.GPT4:              {prompt: 0.03, completion: 0.06},
+	openai.GPT40314:          {prompt: 0.03, completion: 0.06},
+	openai.GPT432K:           {prompt: 0.06, completion: 0.12},
+	openai.GPT432K0314:       {prompt: 0.06, completion: 0.12},
+	openai.GPT3Dot5Turbo:     {prompt: 0.002, completion: 0.002},
+	openai.GPT3Dot5Turbo0301: {prompt: 0.002, completion: 0.002},
+}
+
+// Cost estimates the costs in dollars. Models without a known price are free.
+func (u Usage) Cost() float64 {
+	p := prices[u.Model]
+	return float64(u.PromptTokens)/1000*p.prompt + float64(u.CompletionTokens)/1000*p.completion
+}
+
+// Budget pauses processing when the costs of the current month exceed the
+// limit. A limit of zero means there is no budget.
+type Budget struct {
+	limit     float64
+	usageRepo storage.UsageRepository
+	interval  time.Duration
+	logger    *slog.Logger
+}
+
+func NewBudget(limit float64, usageRepo storage.UsageRepository, interval time.Duration, logger *slog.Logger) *Budget {
+	return &Budget{
+		limit:     limit,
+		usageRepo: usageRepo,
+		interval:  interval,
+		logger:    logger,
+	}
+}
+
+// Wait blocks as long as the budget for the current month is spent
+func (b *Budget) Wait(ctx context.Context) error {
+	if b.limit <= 0 {
+		return nil
+	}
+
+	paused := false
+	for {
+		now := time.Now()
+		spent, err := b.usageRepo.CostSince(time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location()))
+		if err != nil {
+			return err
+		}
+		if spent < b.limit {
+			if paused {
+				b.logger.Info("monthly budget available, resuming processing", slog.Float64("spent", spent), slog.Float64("limit", b.limit))
+			}
+			return nil
+		}
+		if !paused {
+			b.logger.Info("monthly budget exceeded, pausing processing", slog.Float64("spent", spent), slog.Float64("limit", b.limit))
+			paused = true
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(b.interval):
+		}
+	}
+}
@@ -7,12 +7,16 @@ import (
 	"os"
 	"os/signal"
 	"strconv"
+	"strings"
 	"time"
 
 	"go-mod.ewintr.nl/yogai/fetch"
 	"go-mod.ewintr.nl/yogai/handler"
+	"go-mod.ewintr.nl/yogai/metrics"
 	"go-mod.ewintr.nl/yogai/process"
 	"go-mod.ewintr.nl/yogai/storage"
+	"go-mod.ewintr.nl/yogai/tracing"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/sashabaranov/go-openai"
 	"golang.org/x/exp/slog"
 	"google.golang.org/api/option"
@@ -24,24 +28,71 @@ func main() {
 	ctx := context.Background()
 	logger := slog.New(slog.NewTextHandler(os.Stdout))
 
-	postgres, err := storage.NewPostgres(storage.PostgresInfo{
-		Host:     getParam("POSTGRES_HOST", "localhost"),
-		Port:     getParam("POSTGRES_PORT", "5432"),
-		User:     getParam("POSTGRES_USER", "yogai"),
-		Password: getParam("POSTGRES_PASSWORD", "yogai"),
-		Database: getParam("POSTGRES_DB", "yogai"),
-	})
+	if len(os.Args) > 1 && os.Args[1] == "apikey" {
+		if err := runAPIKey(os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// start serving health checks before anything else, so that the
+	// orchestrator can see the service is alive but not ready during startup
+	port, err := strconv.Atoi(getParam("API_PORT", "8080"))
+	if err != nil {
+		logger.Error("invalid port", err)
+		os.Exit(1)
+	}
+	health := handler.NewHealth(5 * time.Second)
+	health.Start("startup")
+	startup := handler.NewStartup(health)
+	go http.ListenAndServe(fmt.Sprintf(":%d", port), startup)
+	logger.Info("http server started")
+
+	shutdownTracing, err := tracing.Setup(ctx, getParam("TRACE_EXPORTER", tracing.ExporterNone))
+	if err != nil {
+		logger.Error("unable to set up tracing", err)
+		os.Exit(1)
+	}
+
+	health.Start("migrations")
+	postgres, err := storage.NewPostgres(postgresInfo())
 	if err != nil {
 		logger.Error("unable to connect to postgres", err)
 		os.Exit(1)
 	}
+	health.Done("migrations")
+	health.AddCheck("postgres", postgres.Ping)
 	videoRelRepo := storage.NewPostgresVideoRepository(postgres)
 	feedRelRepo := storage.NewPostgresFeedRepository(postgres)
+	usageRepo := storage.NewPostgresUsageRepository(postgres)
+	jobQueue := storage.NewPostgresJobQueue(postgres)
+	eventRepo := storage.NewPostgresVideoEventRepository(postgres)
+	playlistRepo := storage.NewPostgresPlaylistRepository(postgres)
 
-	mflxClient := fetch.NewMiniflux(fetch.MinifluxInfo{
+	mflxInfo := fetch.MinifluxInfo{
 		Endpoint: getParam("MINIFLUX_ENDPOINT", "http://localhost/v1"),
 		ApiKey:   getParam("MINIFLUX_APIKEY", ""),
-	})
+	}
+	if mflxInfo.CategoryID, err = strconv.ParseInt(getParam("MINIFLUX_CATEGORY_ID", "0"), 10, 64); err != nil {
+		logger.Error("unable to parse miniflux category id", err)
+		os.Exit(1)
+	}
+	if ids := getParam("MINIFLUX_FEED_IDS", ""); ids != "" {
+		for _, id := range strings.Split(ids, ",") {
+			feedID, err := strconv.ParseInt(strings.TrimSpace(id), 10, 64)
+			if err != nil {
+				logger.Error("unable to parse miniflux feed ids", err)
+				os.Exit(1)
+			}
+			mflxInfo.FeedIDs = append(mflxInfo.FeedIDs, feedID)
+		}
+	}
+	if mflxInfo.CategoryID == 0 && len(mflxInfo.FeedIDs) == 0 {
+		logger.Warn("reading all miniflux feeds, set MINIFLUX_CATEGORY_ID or MINIFLUX_FEED_IDS to limit this")
+	}
+	mflxClient := fetch.NewMiniflux(mflxInfo)
+	health.AddCheck("miniflux", mflxClient.Ping)
 
 	fetchInterval, err := time.ParseDuration(getParam("FETCH_INTERVAL", "1m"))
 	if err != nil {
@@ -49,15 +100,52 @@ func main() {
 		os.Exit(1)
 	}
 
+	channelRefresh, err := time.ParseDuration(getParam("CHANNEL_REFRESH_INTERVAL", "24h"))
+	if err != nil {
+		logger.Error("unable to parse channel refresh interval", err)
+		os.Exit(1)
+	}
+
+	statsRefresh, err := time.ParseDuration(getParam("STATISTICS_REFRESH_INTERVAL", "24h"))
+	if err != nil {
+		logger.Error("unable to parse statistics refresh interval", err)
+		os.Exit(1)
+	}
+
+	unavailableRecheck, err := time.ParseDuration(getParam("UNAVAILABLE_RECHECK_INTERVAL", "24h"))
+	if err != nil {
+		logger.Error("unable to parse unavailable recheck interval", err)
+		os.Exit(1)
+	}
+
 	yt, err := youtube.NewService(ctx, option.WithAPIKey(getParam("YOUTUBE_API_KEY", "")))
 	if err != nil {
 		logger.Error("unable to create youtube service", err)
 		os.Exit(1)
 	}
-	ytClient := fetch.NewYoutube(yt)
+	ytClient := fetch.NewYoutube(yt, getParam("YOUTUBE_REGION", ""))
+
+	openaiRPM, err := strconv.Atoi(getParam("OPENAI_REQUESTS_PER_MINUTE", "200"))
+	if err != nil {
+		logger.Error("unable to parse openai requests per minute", err)
+		os.Exit(1)
+	}
+	openaiTPM, err := strconv.Atoi(getParam("OPENAI_TOKENS_PER_MINUTE", "40000"))
+	if err != nil {
+		logger.Error("unable to parse openai tokens per minute", err)
+		os.Exit(1)
+	}
+	limiter := process.NewRateLimiter(openaiRPM, openaiTPM)
 
 	openaiKey := getParam("OPENAI_API_KEY", "")
-	openAIClient := openai.NewClient(openaiKey)
+	openaiConfig := openai.DefaultConfig(openaiKey)
+	openaiConfig.HTTPClient = &http.Client{Transport: limiter.Transport(http.DefaultTransport, 5)}
+	openAIClient := openai.NewClientWithConfig(openaiConfig)
+	// every call counts against the rate limits, so probes share one answer
+	health.AddCheck("openai", handler.CachedCheck(func(ctx context.Context) error {
+		_, err := openAIClient.ListModels(ctx)
+		return err
+	}, time.Minute))
 
 	wvResetSchema := getParam("WEAVIATE_RESET_SCHEMA", "false") == "true"
 	wvClient, err := storage.NewWeaviate(getParam("WEAVIATE_HOST", ""), getParam("WEAVIATE_API_KEY", ""), openaiKey)
@@ -65,39 +153,119 @@ func main() {
 		logger.Error("unable to create weaviate client", err)
 		os.Exit(1)
 	}
+	health.AddCheck("weaviate", wvClient.Ping)
 	if wvResetSchema {
 		logger.Info("resetting weaviate schema")
+		health.Start("weaviate schema reset")
 		if err := wvClient.ResetSchema(); err != nil {
 			logger.Error("unable to reset weaviate schema", err)
 			os.Exit(1)
 		}
+		health.Done("weaviate schema reset")
+	}
+
+	var cacheRepo storage.LLMCacheRepository
+	if getParam("LLM_CACHE", "true") == "true" {
+		cacheRepo = storage.NewPostgresLLMCacheRepository(postgres)
+	}
+	minConfidence, err := strconv.ParseFloat(getParam("CLASSIFIER_MIN_CONFIDENCE", "0.7"), 64)
+	if err != nil {
+		logger.Error("unable to parse classifier minimum confidence", err)
+		os.Exit(1)
+	}
+	procs, err := process.NewProcessors(openAIClient, limiter, process.NewPrompts(getParam("PROMPT_DIR", "")), cacheRepo, minConfidence, logger)
+	if err != nil {
+		logger.Error("unable to load prompts", err)
+		os.Exit(1)
 	}
 
-	fetcher := fetch.NewFetch(feedRelRepo, videoRelRepo, ytClient, mflxClient, fetchInterval, ytClient, logger)
+	fetcher := fetch.NewFetch(feedRelRepo, videoRelRepo, eventRepo, playlistRepo, jobQueue, ytClient, ytClient, mflxClient, fetchInterval, channelRefresh, statsRefresh, unavailableRecheck, ytClient, logger)
 	go fetcher.Run()
 	logger.Info("fetch service started")
 
-	procs := process.NewProcessors(openAIClient)
-	for i := 0; i < 4; i++ {
-		go process.NewPipeline(fetcher.Out(), procs, videoRelRepo, wvClient, logger.With(slog.Int("pipeline", i))).Run()
+	switch syncMode := getParam("MINIFLUX_SYNC", "report"); syncMode {
+	case "off":
+	case "report", "fix":
+		syncInterval, err := time.ParseDuration(getParam("MINIFLUX_SYNC_INTERVAL", "1h"))
+		if err != nil {
+			logger.Error("unable to parse miniflux sync interval", err)
+			os.Exit(1)
+		}
+		go fetch.NewSync(feedRelRepo, mflxClient, fetcher, syncInterval, syncMode == "fix", logger).Run()
+	default:
+		logger.Error("invalid miniflux sync mode, must be off, report or fix", slog.String("mode", syncMode))
+		os.Exit(1)
+	}
+
+	if getParam("REPROCESS_OUTDATED", "false") == "true" {
+		go fetcher.FindOutdated(procs.SummaryVersion())
+	}
+
+	monthlyBudget, err := strconv.ParseFloat(getParam("LLM_MONTHLY_BUDGET", "0"), 64)
+	if err != nil {
+		logger.Error("unable to parse monthly budget", err)
+		os.Exit(1)
+	}
+	budget := process.NewBudget(monthlyBudget, usageRepo, 10*time.Minute, logger)
+	pipelineCount, err := strconv.Atoi(getParam("PIPELINE_COUNT", "4"))
+	if err != nil || pipelineCount < 1 {
+		logger.Error("invalid pipeline count", slog.String("count", getParam("PIPELINE_COUNT", "4")))
+		os.Exit(1)
+	}
+	for i := 0; i < pipelineCount; i++ {
+		go process.NewPipeline(jobQueue, procs, videoRelRepo, eventRepo, wvClient, usageRepo, budget, logger.With(slog.Int("pipeline", i))).Run()
 	}
 	logger.Info("processing service started")
 
-	port, err := strconv.Atoi(getParam("API_PORT", "8080"))
+	prometheus.MustRegister(metrics.NewStateCollector(videoRelRepo, feedRelRepo, jobQueue, logger))
+
+	// keys are required by default. API_AUTH=false lets existing clients
+	// without a key keep working while keys are handed out with yogai apikey
+	// create, the admin routes always need a key.
+	anonymous := false
+	switch apiAuth := getParam("API_AUTH", "true"); apiAuth {
+	case "true":
+	case "false":
+		anonymous = true
+		logger.Warn("api accepts requests without key, only the admin routes need one, unset API_AUTH to require keys")
+	default:
+		logger.Error("invalid api auth, must be true or false", slog.String("auth", apiAuth))
+		os.Exit(1)
+	}
+	auth := handler.NewAuth(storage.NewPostgresAPIKeyRepository(postgres), anonymous, logger)
+	apiTimeout, err := time.ParseDuration(getParam("API_TIMEOUT", "30s"))
 	if err != nil {
-		logger.Error("invalid port", err)
+		logger.Error("unable to parse api timeout", err)
 		os.Exit(1)
 	}
-	go http.ListenAndServe(fmt.Sprintf(":%d", port), handler.NewServer(videoRelRepo, logger))
-	logger.Info("http server started")
+	serverConfig := handler.ServerConfig{Timeout: apiTimeout}
+	if origins := getParam("API_CORS_ORIGINS", ""); origins != "" {
+		serverConfig.CORSOrigins = strings.Split(origins, ",")
+	}
+	startup.SetServer(handler.NewServer(serverConfig, videoRelRepo, feedRelRepo, eventRepo, usageRepo, process.NewReprocessor(procs, videoRelRepo, eventRepo, jobQueue), fetcher, auth, health, logger))
+	health.Done("startup")
+	logger.Info("api started")
 
-	done := make(chan os.Signal)
+	done := make(chan os.Signal, 1)
 	signal.Notify(done, os.Interrupt)
 	<-done
 
+	if err := shutdownTracing(ctx); err != nil {
+		logger.Error("unable to flush traces", err)
+	}
 	logger.Info("service stopped")
 }
 
+func postgresInfo() storage.PostgresInfo {
+	return storage.PostgresInfo{
+		Host:     getParam("POSTGRES_HOST", "localhost"),
+		Port:     getParam("POSTGRES_PORT", "5432"),
+		User:     getParam("POSTGRES_USER", "yogai"),
+		Password: getParam("POSTGRES_PASSWORD", "yogai"),
+		Database: getParam("POSTGRES_DB", "yogai"),
+	}
+}
+
 func getParam(param, def string) string {
 	if val, ok := os.LookupEnv(param); ok {
 		return val
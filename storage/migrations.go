@@ -52,4 +52,119 @@ ALTER TABLE video RENAME COLUMN status_new TO status;
 COMMIT;`,
 	`DROP TYPE video_status`,
 	`ALTER TYPE video_status_new RENAME TO video_status`,
+	`ALTER TABLE video ADD COLUMN summary_version VARCHAR(255) NOT NULL DEFAULT ''`,
+	`ALTER TABLE video ADD COLUMN summary_finish_reason VARCHAR(255) NOT NULL DEFAULT ''`,
+	`CREATE TABLE llm_usage (
+id SERIAL PRIMARY KEY,
+video_id uuid NOT NULL REFERENCES video(id),
+processor VARCHAR(255) NOT NULL,
+model VARCHAR(255) NOT NULL,
+prompt_tokens INTEGER NOT NULL,
+completion_tokens INTEGER NOT NULL,
+latency_ms INTEGER NOT NULL,
+cost NUMERIC(12, 6) NOT NULL,
+created_at TIMESTAMP WITH TIME ZONE NOT NULL
+)`,
+	`CREATE INDEX llm_usage_video_processor ON llm_usage (video_id, processor)`,
+	`CREATE TABLE llm_cache (
+key VARCHAR(64) PRIMARY KEY,
+processor VARCHAR(255) NOT NULL,
+prompt_version VARCHAR(255) NOT NULL,
+model VARCHAR(255) NOT NULL,
+input_hash VARCHAR(64) NOT NULL,
+output JSONB NOT NULL,
+created_at TIMESTAMP WITH TIME ZONE NOT NULL
+)`,
+	`CREATE TABLE job (
+id uuid PRIMARY KEY,
+queue VARCHAR(255) NOT NULL,
+subject_id uuid NOT NULL,
+priority INTEGER NOT NULL DEFAULT 0,
+attempts INTEGER NOT NULL DEFAULT 0,
+available_at TIMESTAMP WITH TIME ZONE NOT NULL,
+leased_until TIMESTAMP WITH TIME ZONE,
+last_error TEXT NOT NULL DEFAULT '',
+created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+UNIQUE (queue, subject_id)
+)`,
+	`CREATE INDEX job_lease ON job (queue, priority DESC, created_at)`,
+	`CREATE TABLE video_event (
+id BIGSERIAL PRIMARY KEY,
+video_id uuid NOT NULL REFERENCES video(id),
+type VARCHAR(255) NOT NULL,
+previous_status VARCHAR(255) NOT NULL DEFAULT '',
+status VARCHAR(255) NOT NULL DEFAULT '',
+processor VARCHAR(255) NOT NULL DEFAULT '',
+error TEXT NOT NULL DEFAULT '',
+actor VARCHAR(255) NOT NULL,
+created_at TIMESTAMP WITH TIME ZONE NOT NULL
+)`,
+	`CREATE INDEX video_event_video ON video_event (video_id, created_at)`,
+	`CREATE TABLE api_key (
+id uuid PRIMARY KEY,
+name VARCHAR(255) NOT NULL,
+hash VARCHAR(64) NOT NULL UNIQUE,
+scope VARCHAR(255) NOT NULL,
+created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+revoked_at TIMESTAMP WITH TIME ZONE
+)`,
+	`ALTER TABLE feed
+ADD COLUMN youtube_handle VARCHAR(255) NOT NULL DEFAULT '',
+ADD COLUMN youtube_description TEXT NOT NULL DEFAULT '',
+ADD COLUMN youtube_thumbnails JSONB NOT NULL DEFAULT '{}',
+ADD COLUMN youtube_subscriber_count BIGINT NOT NULL DEFAULT 0,
+ADD COLUMN youtube_video_count BIGINT NOT NULL DEFAULT 0,
+ADD COLUMN youtube_country VARCHAR(255) NOT NULL DEFAULT '',
+ADD COLUMN youtube_default_language VARCHAR(255) NOT NULL DEFAULT '',
+ADD COLUMN refreshed_at TIMESTAMP WITH TIME ZONE`,
+	`ALTER TABLE video
+ADD COLUMN youtube_tags TEXT[] NOT NULL DEFAULT '{}',
+ADD COLUMN youtube_category_id VARCHAR(255) NOT NULL DEFAULT '',
+ADD COLUMN youtube_default_audio_language VARCHAR(255) NOT NULL DEFAULT '',
+ADD COLUMN youtube_thumbnails JSONB NOT NULL DEFAULT '{}',
+ADD COLUMN youtube_caption BOOLEAN NOT NULL DEFAULT false,
+ADD COLUMN youtube_definition VARCHAR(255) NOT NULL DEFAULT '',
+ADD COLUMN youtube_view_count BIGINT NOT NULL DEFAULT 0,
+ADD COLUMN youtube_like_count BIGINT NOT NULL DEFAULT 0,
+ADD COLUMN youtube_comment_count BIGINT NOT NULL DEFAULT 0,
+ADD COLUMN statistics_refreshed_at TIMESTAMP WITH TIME ZONE`,
+	`CREATE INDEX video_statistics_refreshed ON video (statistics_refreshed_at NULLS FIRST)`,
+	`ALTER TYPE video_status ADD VALUE 'unavailable'`,
+	`ALTER TABLE video
+ADD COLUMN unavailable_reason VARCHAR(255) NOT NULL DEFAULT '',
+ADD COLUMN availability_checked_at TIMESTAMP WITH TIME ZONE`,
+	`ALTER TYPE video_status ADD VALUE 'skipped'`,
+	`ALTER TABLE video
+ADD COLUMN video_type VARCHAR(255) NOT NULL DEFAULT '',
+ADD COLUMN skip_reason TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE feed ADD COLUMN video_types VARCHAR(255)[] NOT NULL DEFAULT '{regular}'`,
+	`ALTER TABLE feed ADD COLUMN ingest_rules JSONB NOT NULL DEFAULT '{}'`,
+	`ALTER TABLE video
+ADD COLUMN classification VARCHAR(255) NOT NULL DEFAULT '',
+ADD COLUMN classification_confidence DOUBLE PRECISION NOT NULL DEFAULT 0,
+ADD COLUMN classification_version VARCHAR(255) NOT NULL DEFAULT '',
+ADD COLUMN classification_overridden BOOLEAN NOT NULL DEFAULT false`,
+	`ALTER TABLE video DROP CONSTRAINT IF EXISTS video_youtube_channel_id_fkey`,
+	`ALTER TABLE feed DROP CONSTRAINT IF EXISTS feed_youtube_channel_id_key`,
+	`ALTER TABLE feed
+ADD COLUMN source VARCHAR(255) NOT NULL DEFAULT 'channel',
+ADD COLUMN youtube_playlist_id VARCHAR(255) NOT NULL DEFAULT ''`,
+	`CREATE UNIQUE INDEX feed_channel ON feed (youtube_channel_id) WHERE source = 'channel'`,
+	`CREATE UNIQUE INDEX feed_playlist ON feed (youtube_playlist_id) WHERE source = 'playlist'`,
+	`CREATE TABLE playlist_item (
+feed_id uuid NOT NULL REFERENCES feed(id),
+video_id uuid NOT NULL REFERENCES video(id),
+position BIGINT NOT NULL,
+PRIMARY KEY (feed_id, video_id)
+)`,
+	`CREATE INDEX playlist_item_video ON playlist_item (video_id)`,
+	`ALTER TYPE feed_status ADD VALUE 'ad_hoc'`,
+	`ALTER TABLE job
+ADD COLUMN version INTEGER NOT NULL DEFAULT 0,
+ADD COLUMN failed_at TIMESTAMP WITH TIME ZONE`,
+	`ALTER TABLE video ADD COLUMN version INTEGER NOT NULL DEFAULT 0`,
+	`UPDATE feed SET youtube_thumbnails = '{}' WHERE youtube_thumbnails = 'null'`,
+	`UPDATE video SET youtube_thumbnails = '{}' WHERE youtube_thumbnails = 'null'`,
+	`ALTER TABLE video ADD COLUMN premiere BOOLEAN NOT NULL DEFAULT false`,
+	`ALTER TABLE video ADD COLUMN requested BOOLEAN NOT NULL DEFAULT false`,
 }
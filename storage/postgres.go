@@ -1,10 +1,16 @@
 package storage
 
 import (
+	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"strings"
+	"time"
 
 	"go-mod.ewintr.nl/yogai/model"
+	"github.com/google/uuid"
 	"github.com/lib/pq"
 	_ "github.com/lib/pq"
 )
@@ -35,6 +41,13 @@ func NewPostgres(pgInfo PostgresInfo) (*Postgres, error) {
 	return p, nil
 }
 
+func (p *Postgres) Ping(ctx context.Context) error {
+	return p.db.PingContext(ctx)
+}
+
+const videoSelect = `SELECT id, status, youtube_channel_id, youtube_id, youtube_title, youtube_description, youtube_duration, youtube_published_at, youtube_tags, youtube_category_id, youtube_default_audio_language, youtube_thumbnails, youtube_caption, youtube_definition, youtube_view_count, youtube_like_count, youtube_comment_count, statistics_refreshed_at, unavailable_reason, availability_checked_at, video_type, skip_reason, classification, classification_confidence, classification_version, classification_overridden, summary, summary_version, summary_finish_reason, premiere, requested, version
+FROM video`
+
 type PostgresVideoRepository struct {
 	*Postgres
 }
@@ -43,9 +56,15 @@ func NewPostgresVideoRepository(postgres *Postgres) *PostgresVideoRepository {
 	return &PostgresVideoRepository{postgres}
 }
 
+// Save inserts or updates the video and raises its version. It returns
+// ErrConflict if the stored video has another version than v.
 func (p *PostgresVideoRepository) Save(v *model.Video) error {
-	query := `INSERT INTO video (id, status, youtube_id, youtube_channel_id, youtube_title, youtube_description, youtube_duration, youtube_published_at, summary)
-VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	thumbnails, err := thumbnailsJSON(v.YoutubeThumbnails)
+	if err != nil {
+		return err
+	}
+	query := `INSERT INTO video (id, status, youtube_id, youtube_channel_id, youtube_title, youtube_description, youtube_duration, youtube_published_at, youtube_tags, youtube_category_id, youtube_default_audio_language, youtube_thumbnails, youtube_caption, youtube_definition, youtube_view_count, youtube_like_count, youtube_comment_count, statistics_refreshed_at, unavailable_reason, availability_checked_at, video_type, skip_reason, classification, classification_confidence, classification_version, classification_overridden, summary, summary_version, summary_finish_reason, premiere, requested, version)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22, $23, $24, $25, $26, $27, $28, $29, $30, $31, $32)
 ON CONFLICT (id)
 DO UPDATE SET
   id = EXCLUDED.id,
@@ -56,32 +75,191 @@ DO UPDATE SET
   youtube_description = EXCLUDED.youtube_description,
   youtube_duration = EXCLUDED.youtube_duration,
   youtube_published_at = EXCLUDED.youtube_published_at,
-  summary = EXCLUDED.summary;`
-	_, err := p.db.Exec(query, v.ID, v.Status, v.YoutubeID, v.YoutubeChannelID, v.YoutubeTitle, v.YoutubeDescription, v.YoutubeDuration, v.YoutubePublishedAt, v.Summary)
+  youtube_tags = EXCLUDED.youtube_tags,
+  youtube_category_id = EXCLUDED.youtube_category_id,
+  youtube_default_audio_language = EXCLUDED.youtube_default_audio_language,
+  youtube_thumbnails = EXCLUDED.youtube_thumbnails,
+  youtube_caption = EXCLUDED.youtube_caption,
+  youtube_definition = EXCLUDED.youtube_definition,
+  youtube_view_count = EXCLUDED.youtube_view_count,
+  youtube_like_count = EXCLUDED.youtube_like_count,
+  youtube_comment_count = EXCLUDED.youtube_comment_count,
+  statistics_refreshed_at = EXCLUDED.statistics_refreshed_at,
+  unavailable_reason = EXCLUDED.unavailable_reason,
+  availability_checked_at = EXCLUDED.availability_checked_at,
+  video_type = EXCLUDED.video_type,
+  skip_reason = EXCLUDED.skip_reason,
+  classification = EXCLUDED.classification,
+  classification_confidence = EXCLUDED.classification_confidence,
+  classification_version = EXCLUDED.classification_version,
+  classification_overridden = EXCLUDED.classification_overridden,
+  summary = EXCLUDED.summary,
+  summary_version = EXCLUDED.summary_version,
+  summary_finish_reason = EXCLUDED.summary_finish_reason,
+  premiere = EXCLUDED.premiere,
+  requested = EXCLUDED.requested,
+  version = EXCLUDED.version
+WHERE video.version = EXCLUDED.version - 1;`
+	tags := v.YoutubeTags
+	if tags == nil {
+		tags = []string{}
+	}
+	next := v.Version + 1
+	res, err := p.db.Exec(query, v.ID, v.Status, v.YoutubeID, v.YoutubeChannelID, v.YoutubeTitle, v.YoutubeDescription, v.YoutubeDuration, v.YoutubePublishedAt, pq.Array(tags), v.YoutubeCategoryID, v.YoutubeDefaultAudioLanguage, thumbnails, v.YoutubeCaption, v.YoutubeDefinition, v.YoutubeViewCount, v.YoutubeLikeCount, v.YoutubeCommentCount, v.StatisticsRefreshedAt, v.UnavailableReason, v.AvailabilityCheckedAt, v.Type, v.SkipReason, v.Classification, v.ClassificationConfidence, v.ClassificationVersion, v.ClassificationOverridden, v.Summary, v.SummaryVersion, v.SummaryFinishReason, v.Premiere, v.Requested, next)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrConflict
+	}
+	v.Version = next
+
+	return nil
+}
+
+func (p *PostgresVideoRepository) SaveStatistics(v *model.Video) error {
+	query := `UPDATE video
+SET youtube_view_count = $2,
+  youtube_like_count = $3,
+  youtube_comment_count = $4,
+  statistics_refreshed_at = $5
+WHERE id = $1`
+	_, err := p.db.Exec(query, v.ID, v.YoutubeViewCount, v.YoutubeLikeCount, v.YoutubeCommentCount, v.StatisticsRefreshedAt)
 
 	return err
 }
 
+func (p *PostgresVideoRepository) FindStatisticsBefore(t time.Time, limit int) ([]*model.Video, error) {
+	query := videoSelect + `
+WHERE status = ANY($1) AND (statistics_refreshed_at IS NULL OR statistics_refreshed_at < $2)
+ORDER BY statistics_refreshed_at NULLS FIRST
+LIMIT $3`
+
+	return p.find(query, pq.Array([]model.VideoStatus{model.StatusFetched, model.StatusReady}), t, limit)
+}
+
 func (p *PostgresVideoRepository) FindByStatus(statuses ...model.VideoStatus) ([]*model.Video, error) {
-	query := `SELECT id, status, youtube_channel_id, youtube_id, youtube_title, youtube_description,youtube_duration, youtube_published_at, summary
-FROM video
+	query := videoSelect + `
 WHERE status = ANY($1)`
-	rows, err := p.db.Query(query, pq.Array(statuses))
+
+	return p.find(query, pq.Array(statuses))
+}
+
+func (p *PostgresVideoRepository) FindByID(id uuid.UUID) (*model.Video, error) {
+	query := videoSelect + `
+WHERE id = $1`
+	videos, err := p.find(query, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(videos) == 0 {
+		return nil, ErrNotFound
+	}
+
+	return videos[0], nil
+}
+
+func (p *PostgresVideoRepository) CountByStatus() (map[model.VideoStatus]int, error) {
+	rows, err := p.db.Query(`SELECT status, COUNT(*) FROM video GROUP BY status`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := map[model.VideoStatus]int{}
+	for rows.Next() {
+		var status model.VideoStatus
+		var count int
+		if err := rows.Scan(&status, &count); err != nil {
+			return nil, err
+		}
+		counts[status] = count
+	}
+
+	return counts, rows.Err()
+}
+
+func (p *PostgresVideoRepository) FindByYoutubeID(id model.YoutubeVideoID) (*model.Video, error) {
+	query := videoSelect + `
+WHERE youtube_id = $1`
+	videos, err := p.find(query, id)
 	if err != nil {
 		return nil, err
 	}
+	if len(videos) == 0 {
+		return nil, ErrNotFound
+	}
+
+	return videos[0], nil
+}
+
+// FindOutdated returns the ready videos that have a summary that was made with
+// another prompt version than summaryVersion
+func (p *PostgresVideoRepository) FindOutdated(summaryVersion string) ([]*model.Video, error) {
+	query := videoSelect + `
+WHERE status = $1 AND summary_version <> $2`
+
+	return p.find(query, model.StatusReady, summaryVersion)
+}
+
+func (p *PostgresVideoRepository) FindByFilter(filter model.VideoFilter) ([]*model.Video, error) {
+	where, args := []string{}, []any{}
+	add := func(cond string, arg any) {
+		args = append(args, arg)
+		where = append(where, fmt.Sprintf(cond, len(args)))
+	}
+	if len(filter.IDs) > 0 {
+		ids := make([]string, 0, len(filter.IDs))
+		for _, id := range filter.IDs {
+			ids = append(ids, id.String())
+		}
+		add("id = ANY($%d::uuid[])", pq.Array(ids))
+	}
+	if filter.YoutubeChannelID != "" {
+		add("youtube_channel_id = $%d", filter.YoutubeChannelID)
+	}
+	if len(filter.Statuses) > 0 {
+		add("status = ANY($%d)", pq.Array(filter.Statuses))
+	}
+	if filter.TitleContains != "" {
+		// strpos instead of ILIKE, so that % and _ in the filter are not
+		// wildcards
+		add("strpos(lower(youtube_title), lower($%d)) > 0", filter.TitleContains)
+	}
+
+	query := videoSelect
+	if len(where) > 0 {
+		query += "\nWHERE " + strings.Join(where, " AND ")
+	}
+
+	return p.find(query, args...)
+}
+
+func (p *PostgresVideoRepository) find(query string, args ...any) ([]*model.Video, error) {
+	rows, err := p.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
 
 	videos := []*model.Video{}
 	for rows.Next() {
 		v := &model.Video{}
-		if err := rows.Scan(&v.ID, &v.Status, &v.YoutubeChannelID, &v.YoutubeID, &v.YoutubeTitle, &v.YoutubeDescription, &v.YoutubeDuration, &v.YoutubePublishedAt, &v.Summary); err != nil {
+		var thumbnails []byte
+		if err := rows.Scan(&v.ID, &v.Status, &v.YoutubeChannelID, &v.YoutubeID, &v.YoutubeTitle, &v.YoutubeDescription, &v.YoutubeDuration, &v.YoutubePublishedAt, pq.Array(&v.YoutubeTags), &v.YoutubeCategoryID, &v.YoutubeDefaultAudioLanguage, &thumbnails, &v.YoutubeCaption, &v.YoutubeDefinition, &v.YoutubeViewCount, &v.YoutubeLikeCount, &v.YoutubeCommentCount, &v.StatisticsRefreshedAt, &v.UnavailableReason, &v.AvailabilityCheckedAt, &v.Type, &v.SkipReason, &v.Classification, &v.ClassificationConfidence, &v.ClassificationVersion, &v.ClassificationOverridden, &v.Summary, &v.SummaryVersion, &v.SummaryFinishReason, &v.Premiere, &v.Requested, &v.Version); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(thumbnails, &v.YoutubeThumbnails); err != nil {
 			return nil, err
 		}
 		videos = append(videos, v)
 	}
-	rows.Close()
 
-	return videos, nil
+	return videos, rows.Err()
 }
 
 type PostgresFeedRepository struct {
@@ -93,39 +271,646 @@ func NewPostgresFeedRepository(postgres *Postgres) *PostgresFeedRepository {
 }
 
 func (p *PostgresFeedRepository) Save(f *model.Feed) error {
-	query := `INSERT INTO feed (id, status, youtube_channel_id, title)
-VALUES ($1, $2, $3, $4)
+	thumbnails, err := thumbnailsJSON(f.YoutubeThumbnails)
+	if err != nil {
+		return err
+	}
+	videoTypes := f.VideoTypes
+	if videoTypes == nil {
+		videoTypes = []model.VideoType{model.VideoTypeRegular}
+	}
+	rules, err := json.Marshal(newIngestRules(f.Rules))
+	if err != nil {
+		return err
+	}
+	source := f.Source
+	if source == "" {
+		source = model.FeedSourceChannel
+	}
+	query := `INSERT INTO feed (id, status, source, youtube_channel_id, youtube_playlist_id, title, youtube_handle, youtube_description, youtube_thumbnails, youtube_subscriber_count, youtube_video_count, youtube_country, youtube_default_language, refreshed_at, video_types, ingest_rules)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)
 ON CONFLICT (id)
 DO UPDATE SET
   id = EXCLUDED.id,
   status = EXCLUDED.status,
+  source = EXCLUDED.source,
   youtube_channel_id = EXCLUDED.youtube_channel_id,
-  title = EXCLUDED.title;`
-	_, err := p.db.Exec(query, f.ID, f.Status, f.YoutubeChannelID, f.Title)
+  youtube_playlist_id = EXCLUDED.youtube_playlist_id,
+  title = EXCLUDED.title,
+  youtube_handle = EXCLUDED.youtube_handle,
+  youtube_description = EXCLUDED.youtube_description,
+  youtube_thumbnails = EXCLUDED.youtube_thumbnails,
+  youtube_subscriber_count = EXCLUDED.youtube_subscriber_count,
+  youtube_video_count = EXCLUDED.youtube_video_count,
+  youtube_country = EXCLUDED.youtube_country,
+  youtube_default_language = EXCLUDED.youtube_default_language,
+  refreshed_at = EXCLUDED.refreshed_at,
+  video_types = EXCLUDED.video_types,
+  ingest_rules = EXCLUDED.ingest_rules;`
+	_, err = p.db.Exec(query, f.ID, f.Status, source, f.YoutubeChannelID, f.YoutubePlaylistID, f.Title, f.YoutubeHandle, f.YoutubeDescription, thumbnails, f.YoutubeSubscriberCount, f.YoutubeVideoCount, f.YoutubeCountry, f.YoutubeDefaultLanguage, f.RefreshedAt, pq.Array(videoTypes), rules)
 
 	return err
 }
 
+// SaveMetadata only updates the metadata from YouTube and the refresh time, so
+// that it does not undo a change of the status or the rules that was made
+// while the metadata was fetched.
+func (p *PostgresFeedRepository) SaveMetadata(f *model.Feed) error {
+	thumbnails, err := thumbnailsJSON(f.YoutubeThumbnails)
+	if err != nil {
+		return err
+	}
+	query := `UPDATE feed
+SET youtube_channel_id = $2,
+  title = $3,
+  youtube_handle = $4,
+  youtube_description = $5,
+  youtube_thumbnails = $6,
+  youtube_subscriber_count = $7,
+  youtube_video_count = $8,
+  youtube_country = $9,
+  youtube_default_language = $10,
+  refreshed_at = $11
+WHERE id = $1`
+	return p.update(query, f.ID, f.YoutubeChannelID, f.Title, f.YoutubeHandle, f.YoutubeDescription, thumbnails, f.YoutubeSubscriberCount, f.YoutubeVideoCount, f.YoutubeCountry, f.YoutubeDefaultLanguage, f.RefreshedAt)
+}
+
+func (p *PostgresFeedRepository) SaveStatus(f *model.Feed) error {
+	return p.update(`UPDATE feed SET status = $2 WHERE id = $1`, f.ID, f.Status)
+}
+
+func (p *PostgresFeedRepository) SaveRules(f *model.Feed) error {
+	videoTypes := f.VideoTypes
+	if videoTypes == nil {
+		videoTypes = []model.VideoType{model.VideoTypeRegular}
+	}
+	rules, err := json.Marshal(newIngestRules(f.Rules))
+	if err != nil {
+		return err
+	}
+
+	return p.update(`UPDATE feed SET video_types = $2, ingest_rules = $3 WHERE id = $1`, f.ID, pq.Array(videoTypes), rules)
+}
+
+func (p *PostgresFeedRepository) update(query string, args ...any) error {
+	res, err := p.db.Exec(query, args...)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// thumbnailsJSON stores missing thumbnails as an empty object instead of null
+func thumbnailsJSON(t model.Thumbnails) ([]byte, error) {
+	if t == nil {
+		t = model.Thumbnails{}
+	}
+
+	return json.Marshal(t)
+}
+
+const feedSelect = `SELECT id, status, source, youtube_channel_id, youtube_playlist_id, title, youtube_handle, youtube_description, youtube_thumbnails, youtube_subscriber_count, youtube_video_count, youtube_country, youtube_default_language, refreshed_at, video_types, ingest_rules
+FROM feed`
+
 func (p *PostgresFeedRepository) FindByStatus(statuses ...model.FeedStatus) ([]*model.Feed, error) {
-	query := `SELECT id, status, youtube_channel_id, title
-FROM feed
+	query := feedSelect + `
 WHERE status = ANY($1)`
-	rows, err := p.db.Query(query, pq.Array(statuses))
+
+	return p.find(query, pq.Array(statuses))
+}
+
+func (p *PostgresFeedRepository) FindAll() ([]*model.Feed, error) {
+	query := feedSelect + `
+ORDER BY title`
+
+	return p.find(query)
+}
+
+func (p *PostgresFeedRepository) FindRefreshedBefore(t time.Time) ([]*model.Feed, error) {
+	query := feedSelect + `
+WHERE refreshed_at IS NULL OR refreshed_at < $1`
+
+	return p.find(query, t)
+}
+
+func (p *PostgresFeedRepository) CountByStatus() (map[model.FeedStatus]int, error) {
+	rows, err := p.db.Query(`SELECT status, COUNT(*) FROM feed GROUP BY status`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := map[model.FeedStatus]int{}
+	for rows.Next() {
+		var status model.FeedStatus
+		var count int
+		if err := rows.Scan(&status, &count); err != nil {
+			return nil, err
+		}
+		counts[status] = count
+	}
+
+	return counts, rows.Err()
+}
+
+func (p *PostgresFeedRepository) FindByID(id uuid.UUID) (*model.Feed, error) {
+	return p.findOne(feedSelect+`
+WHERE id = $1`, id)
+}
+
+func (p *PostgresFeedRepository) FindByYoutubeChannelID(id model.YoutubeChannelID) (*model.Feed, error) {
+	return p.findOne(feedSelect+`
+WHERE source = $1 AND youtube_channel_id = $2`, model.FeedSourceChannel, id)
+}
+
+func (p *PostgresFeedRepository) FindByYoutubePlaylistID(id model.YoutubePlaylistID) (*model.Feed, error) {
+	return p.findOne(feedSelect+`
+WHERE source = $1 AND youtube_playlist_id = $2`, model.FeedSourcePlaylist, id)
+}
+
+func (p *PostgresFeedRepository) findOne(query string, args ...any) (*model.Feed, error) {
+	feeds, err := p.find(query, args...)
 	if err != nil {
 		return nil, err
 	}
+	if len(feeds) == 0 {
+		return nil, ErrNotFound
+	}
+
+	return feeds[0], nil
+}
+
+func (p *PostgresFeedRepository) find(query string, args ...any) ([]*model.Feed, error) {
+	rows, err := p.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
 
 	feeds := []*model.Feed{}
 	for rows.Next() {
 		f := &model.Feed{}
-		if err := rows.Scan(&f.ID, &f.Status, &f.YoutubeChannelID, &f.Title); err != nil {
+		var thumbnails []byte
+		var videoTypes pq.StringArray
+		var rules []byte
+		if err := rows.Scan(&f.ID, &f.Status, &f.Source, &f.YoutubeChannelID, &f.YoutubePlaylistID, &f.Title, &f.YoutubeHandle, &f.YoutubeDescription, &thumbnails, &f.YoutubeSubscriberCount, &f.YoutubeVideoCount, &f.YoutubeCountry, &f.YoutubeDefaultLanguage, &f.RefreshedAt, &videoTypes, &rules); err != nil {
+			return nil, err
+		}
+		r := ingestRules{}
+		if err := json.Unmarshal(rules, &r); err != nil {
+			return nil, err
+		}
+		f.Rules = r.model()
+		for _, vt := range videoTypes {
+			f.VideoTypes = append(f.VideoTypes, model.VideoType(vt))
+		}
+		if err := json.Unmarshal(thumbnails, &f.YoutubeThumbnails); err != nil {
 			return nil, err
 		}
 		feeds = append(feeds, f)
 	}
-	rows.Close()
 
-	return feeds, nil
+	return feeds, rows.Err()
+}
+
+// ingestRules is how model.IngestRules are stored in the feed table
+type ingestRules struct {
+	IncludeTitles  []string   `json:"include_titles,omitempty"`
+	ExcludeTitles  []string   `json:"exclude_titles,omitempty"`
+	MinDuration    int64      `json:"min_duration_seconds,omitempty"`
+	MaxDuration    int64      `json:"max_duration_seconds,omitempty"`
+	PublishedAfter *time.Time `json:"published_after,omitempty"`
+	Keywords       []string   `json:"keywords,omitempty"`
+}
+
+func newIngestRules(r model.IngestRules) ingestRules {
+	return ingestRules{
+		IncludeTitles:  r.IncludeTitles,
+		ExcludeTitles:  r.ExcludeTitles,
+		MinDuration:    int64(r.MinDuration.Seconds()),
+		MaxDuration:    int64(r.MaxDuration.Seconds()),
+		PublishedAfter: r.PublishedAfter,
+		Keywords:       r.Keywords,
+	}
+}
+
+// model returns the rules compiled. A rule that does not compile is not an
+// error here, Check reports it for every video of the feed.
+func (r ingestRules) model() model.IngestRules {
+	rules := model.IngestRules{
+		IncludeTitles:  r.IncludeTitles,
+		ExcludeTitles:  r.ExcludeTitles,
+		MinDuration:    time.Duration(r.MinDuration) * time.Second,
+		MaxDuration:    time.Duration(r.MaxDuration) * time.Second,
+		PublishedAfter: r.PublishedAfter,
+		Keywords:       r.Keywords,
+	}
+	rules.Compile()
+
+	return rules
+}
+
+type PostgresVideoEventRepository struct {
+	*Postgres
+}
+
+func NewPostgresVideoEventRepository(postgres *Postgres) *PostgresVideoEventRepository {
+	return &PostgresVideoEventRepository{postgres}
+}
+
+func (p *PostgresVideoEventRepository) Add(e *model.VideoEvent) error {
+	query := `INSERT INTO video_event (video_id, type, previous_status, status, processor, error, actor, created_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+RETURNING id`
+
+	return p.db.QueryRow(query, e.VideoID, e.Type, e.PreviousStatus, e.Status, e.Processor, e.Error, e.Actor, e.CreatedAt).Scan(&e.ID)
+}
+
+func (p *PostgresVideoEventRepository) FindByVideo(videoID uuid.UUID) ([]*model.VideoEvent, error) {
+	query := `SELECT id, video_id, type, previous_status, status, processor, error, actor, created_at
+FROM video_event
+WHERE video_id = $1
+ORDER BY created_at, id`
+	rows, err := p.db.Query(query, videoID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []*model.VideoEvent{}
+	for rows.Next() {
+		e := &model.VideoEvent{}
+		if err := rows.Scan(&e.ID, &e.VideoID, &e.Type, &e.PreviousStatus, &e.Status, &e.Processor, &e.Error, &e.Actor, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+
+	return events, rows.Err()
+}
+
+type PostgresPlaylistRepository struct {
+	*Postgres
+}
+
+func NewPostgresPlaylistRepository(postgres *Postgres) *PostgresPlaylistRepository {
+	return &PostgresPlaylistRepository{postgres}
+}
+
+func (p *PostgresPlaylistRepository) Save(item *model.PlaylistItem) error {
+	query := `INSERT INTO playlist_item (feed_id, video_id, position)
+VALUES ($1, $2, $3)
+ON CONFLICT (feed_id, video_id)
+DO UPDATE SET
+  position = EXCLUDED.position;`
+	_, err := p.db.Exec(query, item.FeedID, item.VideoID, item.Position)
+
+	return err
+}
+
+func (p *PostgresPlaylistRepository) Delete(item *model.PlaylistItem) error {
+	_, err := p.db.Exec(`DELETE FROM playlist_item WHERE feed_id = $1 AND video_id = $2`, item.FeedID, item.VideoID)
+
+	return err
+}
+
+func (p *PostgresPlaylistRepository) FindByFeed(feedID uuid.UUID) ([]*model.PlaylistItem, error) {
+	return p.find(`SELECT feed_id, video_id, position
+FROM playlist_item
+WHERE feed_id = $1
+ORDER BY position`, feedID)
+}
+
+func (p *PostgresPlaylistRepository) FindByVideo(videoID uuid.UUID) ([]*model.PlaylistItem, error) {
+	return p.find(`SELECT feed_id, video_id, position
+FROM playlist_item
+WHERE video_id = $1`, videoID)
+}
+
+func (p *PostgresPlaylistRepository) find(query string, args ...any) ([]*model.PlaylistItem, error) {
+	rows, err := p.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []*model.PlaylistItem{}
+	for rows.Next() {
+		item := &model.PlaylistItem{}
+		if err := rows.Scan(&item.FeedID, &item.VideoID, &item.Position); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+
+	return items, rows.Err()
+}
+
+type PostgresUsageRepository struct {
+	*Postgres
+}
+
+func NewPostgresUsageRepository(postgres *Postgres) *PostgresUsageRepository {
+	return &PostgresUsageRepository{postgres}
+}
+
+func (p *PostgresUsageRepository) Save(u *model.LLMUsage) error {
+	query := `INSERT INTO llm_usage (video_id, processor, model, prompt_tokens, completion_tokens, latency_ms, cost, created_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
+	_, err := p.db.Exec(query, u.VideoID, u.Processor, u.Model, u.PromptTokens, u.CompletionTokens, u.Latency.Milliseconds(), u.Cost, u.CreatedAt)
+
+	return err
+}
+
+func (p *PostgresUsageRepository) CostSince(since time.Time) (float64, error) {
+	query := `SELECT COALESCE(SUM(cost), 0)
+FROM llm_usage
+WHERE created_at >= $1`
+	var cost float64
+	if err := p.db.QueryRow(query, since).Scan(&cost); err != nil {
+		return 0, err
+	}
+
+	return cost, nil
+}
+
+var usageGroupColumns = map[model.UsageGroup]string{
+	model.UsageGroupDay:       `to_char(u.created_at, 'YYYY-MM-DD')`,
+	model.UsageGroupChannel:   `v.youtube_channel_id`,
+	model.UsageGroupProcessor: `u.processor`,
+}
+
+func (p *PostgresUsageRepository) Summarize(group model.UsageGroup, since time.Time) ([]model.UsageSummary, error) {
+	column, ok := usageGroupColumns[group]
+	if !ok {
+		return nil, fmt.Errorf("unknown usage group %q", group)
+	}
+	query := fmt.Sprintf(`SELECT %s AS key, COUNT(*), SUM(u.prompt_tokens), SUM(u.completion_tokens), SUM(u.cost)
+FROM llm_usage u
+JOIN video v ON v.id = u.video_id
+WHERE u.created_at >= $1
+GROUP BY key
+ORDER BY key`, column)
+	rows, err := p.db.Query(query, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	summaries := []model.UsageSummary{}
+	for rows.Next() {
+		s := model.UsageSummary{}
+		if err := rows.Scan(&s.Key, &s.Runs, &s.PromptTokens, &s.CompletionTokens, &s.Cost); err != nil {
+			return nil, err
+		}
+		summaries = append(summaries, s)
+	}
+
+	return summaries, rows.Err()
+}
+
+type PostgresLLMCacheRepository struct {
+	*Postgres
+}
+
+func NewPostgresLLMCacheRepository(postgres *Postgres) *PostgresLLMCacheRepository {
+	return &PostgresLLMCacheRepository{postgres}
+}
+
+func (p *PostgresLLMCacheRepository) Find(key string) (*model.LLMCacheEntry, error) {
+	query := `SELECT key, processor, prompt_version, model, input_hash, output, created_at
+FROM llm_cache
+WHERE key = $1`
+	e := &model.LLMCacheEntry{}
+	err := p.db.QueryRow(query, key).Scan(&e.Key, &e.Processor, &e.PromptVersion, &e.Model, &e.InputHash, &e.Output, &e.CreatedAt)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return nil, ErrNotFound
+	case err != nil:
+		return nil, err
+	}
+
+	return e, nil
+}
+
+func (p *PostgresLLMCacheRepository) Save(e *model.LLMCacheEntry) error {
+	query := `INSERT INTO llm_cache (key, processor, prompt_version, model, input_hash, output, created_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
+ON CONFLICT (key)
+DO UPDATE SET
+  output = EXCLUDED.output,
+  created_at = EXCLUDED.created_at;`
+	_, err := p.db.Exec(query, e.Key, e.Processor, e.PromptVersion, e.Model, e.InputHash, e.Output, e.CreatedAt)
+
+	return err
+}
+
+type PostgresAPIKeyRepository struct {
+	*Postgres
+}
+
+func NewPostgresAPIKeyRepository(postgres *Postgres) *PostgresAPIKeyRepository {
+	return &PostgresAPIKeyRepository{postgres}
+}
+
+func (p *PostgresAPIKeyRepository) Save(k *model.APIKey) error {
+	query := `INSERT INTO api_key (id, name, hash, scope, created_at, revoked_at)
+VALUES ($1, $2, $3, $4, $5, $6)
+ON CONFLICT (id)
+DO UPDATE SET
+  name = EXCLUDED.name,
+  scope = EXCLUDED.scope,
+  revoked_at = EXCLUDED.revoked_at;`
+	_, err := p.db.Exec(query, k.ID, k.Name, k.Hash, k.Scope, k.CreatedAt, k.RevokedAt)
+
+	return err
+}
+
+func (p *PostgresAPIKeyRepository) FindByHash(hash string) (*model.APIKey, error) {
+	query := `SELECT id, name, hash, scope, created_at, revoked_at
+FROM api_key
+WHERE hash = $1`
+	k := &model.APIKey{}
+	err := p.db.QueryRow(query, hash).Scan(&k.ID, &k.Name, &k.Hash, &k.Scope, &k.CreatedAt, &k.RevokedAt)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return nil, ErrNotFound
+	case err != nil:
+		return nil, err
+	}
+
+	return k, nil
+}
+
+func (p *PostgresAPIKeyRepository) FindAll() ([]*model.APIKey, error) {
+	query := `SELECT id, name, hash, scope, created_at, revoked_at
+FROM api_key
+ORDER BY created_at`
+	rows, err := p.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []*model.APIKey{}
+	for rows.Next() {
+		k := &model.APIKey{}
+		if err := rows.Scan(&k.ID, &k.Name, &k.Hash, &k.Scope, &k.CreatedAt, &k.RevokedAt); err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+
+	return keys, rows.Err()
+}
+
+// Revoke marks the key as revoked. Keys that are already revoked keep their
+// original revocation time.
+func (p *PostgresAPIKeyRepository) Revoke(id uuid.UUID) error {
+	query := `UPDATE api_key
+SET revoked_at = COALESCE(revoked_at, NOW())
+WHERE id = $1`
+	res, err := p.db.Exec(query, id)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+type PostgresJobQueue struct {
+	*Postgres
+}
+
+func NewPostgresJobQueue(postgres *Postgres) *PostgresJobQueue {
+	return &PostgresJobQueue{postgres}
+}
+
+// Enqueue adds a job for the subject. If there already is one, it gets the
+// highest of the two priorities and it counts as a new request: it becomes
+// available right away, gets a fresh set of attempts and its version is raised.
+// If the job is leased at that moment, the raised version keeps the worker
+// from acking the new request away.
+func (p *PostgresJobQueue) Enqueue(queue model.Queue, subjectID uuid.UUID, priority int) error {
+	query := `INSERT INTO job (id, queue, subject_id, priority, available_at, created_at)
+VALUES ($1, $2, $3, $4, NOW(), NOW())
+ON CONFLICT (queue, subject_id)
+DO UPDATE SET
+  priority = GREATEST(job.priority, EXCLUDED.priority),
+  available_at = LEAST(job.available_at, EXCLUDED.available_at),
+  attempts = 0,
+  failed_at = NULL,
+  version = job.version + 1;`
+	_, err := p.db.Exec(query, uuid.New(), queue, subjectID, priority)
+
+	return err
+}
+
+// Lease returns at most max available jobs, highest priority first, and hides
+// them from other workers for the visibility duration. Rows that are locked by
+// a concurrent lease are skipped.
+func (p *PostgresJobQueue) Lease(queue model.Queue, max int, visibility time.Duration) ([]*model.Job, error) {
+	query := `UPDATE job
+SET leased_until = NOW() + $3 * INTERVAL '1 millisecond',
+  attempts = attempts + 1
+WHERE id IN (
+  SELECT id FROM job
+  WHERE queue = $1
+    AND failed_at IS NULL
+    AND available_at <= NOW()
+    AND (leased_until IS NULL OR leased_until < NOW())
+  ORDER BY priority DESC, created_at
+  LIMIT $2
+  FOR UPDATE SKIP LOCKED
+)
+RETURNING id, queue, subject_id, priority, attempts, version`
+	rows, err := p.db.Query(query, queue, max, visibility.Milliseconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	jobs := []*model.Job{}
+	for rows.Next() {
+		j := &model.Job{}
+		if err := rows.Scan(&j.ID, &j.Queue, &j.SubjectID, &j.Priority, &j.Attempts, &j.Version); err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, j)
+	}
+
+	return jobs, rows.Err()
+}
+
+// Ack removes the job. If the subject was enqueued again while the job was
+// leased, the job is released instead, so the new request is not lost.
+func (p *PostgresJobQueue) Ack(job *model.Job) error {
+	res, err := p.db.Exec(`DELETE FROM job WHERE id = $1 AND version = $2`, job.ID, job.Version)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n > 0 {
+		return err
+	}
+	_, err = p.db.Exec(`UPDATE job SET leased_until = NULL WHERE id = $1`, job.ID)
+
+	return err
+}
+
+// Nack releases the job, so that it becomes available again after delay. A
+// job that failed with an error and has no attempts left is marked as failed
+// and will not be leased again. Both do not apply if the subject was enqueued
+// again while the job was leased, then the new request is available right away.
+func (p *PostgresJobQueue) Nack(job *model.Job, jobErr error, delay time.Duration) error {
+	query := `UPDATE job
+SET leased_until = NULL,
+  available_at = CASE WHEN version = $4 THEN NOW() + $2 * INTERVAL '1 millisecond' ELSE available_at END,
+  failed_at = CASE WHEN version = $4 AND $5 THEN NOW() ELSE NULL END,
+  last_error = $3
+WHERE id = $1`
+	msg := ""
+	if jobErr != nil {
+		msg = jobErr.Error()
+	}
+	failed := jobErr != nil && job.Exhausted()
+	_, err := p.db.Exec(query, job.ID, delay.Milliseconds(), msg, job.Version, failed)
+
+	return err
+}
+
+func (p *PostgresJobQueue) Depth() (map[model.Queue]int, error) {
+	rows, err := p.db.Query(`SELECT queue, COUNT(*) FROM job WHERE failed_at IS NULL GROUP BY queue`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	depths := map[model.Queue]int{}
+	for rows.Next() {
+		var queue model.Queue
+		var count int
+		if err := rows.Scan(&queue, &count); err != nil {
+			return nil, err
+		}
+		depths[queue] = count
+	}
+
+	return depths, rows.Err()
 }
 
 func (p *Postgres) migrate(wanted []string) error {
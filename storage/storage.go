@@ -2,20 +2,102 @@ package storage
 
 import (
 	"context"
+	"errors"
+	"time"
 
 	"go-mod.ewintr.nl/yogai/model"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrNotFound = errors.New("not found")
+	ErrExists   = errors.New("already exists")
+	// ErrConflict means the record was changed by someone else since it was
+	// read
+	ErrConflict = errors.New("changed concurrently")
 )
 
 type FeedRelRepository interface {
 	Save(feed *model.Feed) error
+	// SaveMetadata, SaveStatus and SaveRules only update their part of an
+	// existing feed, so that concurrent changes to the other parts are kept
+	SaveMetadata(feed *model.Feed) error
+	SaveStatus(feed *model.Feed) error
+	SaveRules(feed *model.Feed) error
+	FindByID(id uuid.UUID) (*model.Feed, error)
+	// FindByYoutubeChannelID returns the channel feed, not the playlist feeds
+	// of the channel
+	FindByYoutubeChannelID(id model.YoutubeChannelID) (*model.Feed, error)
+	FindByYoutubePlaylistID(id model.YoutubePlaylistID) (*model.Feed, error)
 	FindByStatus(statuses ...model.FeedStatus) ([]*model.Feed, error)
+	FindAll() ([]*model.Feed, error)
+	// FindRefreshedBefore returns the feeds with channel metadata that was
+	// fetched before t, or never
+	FindRefreshedBefore(t time.Time) ([]*model.Feed, error)
+	CountByStatus() (map[model.FeedStatus]int, error)
+}
+
+type PlaylistRepository interface {
+	// Save adds the video to the playlist or updates its position
+	Save(item *model.PlaylistItem) error
+	Delete(item *model.PlaylistItem) error
+	// FindByFeed returns the items of the playlist, ordered by position
+	FindByFeed(feedID uuid.UUID) ([]*model.PlaylistItem, error)
+	FindByVideo(videoID uuid.UUID) ([]*model.PlaylistItem, error)
 }
 
 type VideoRelRepository interface {
 	Save(video *model.Video) error
+	FindByID(id uuid.UUID) (*model.Video, error)
+	FindByYoutubeID(id model.YoutubeVideoID) (*model.Video, error)
 	FindByStatus(statuses ...model.VideoStatus) ([]*model.Video, error)
+	FindOutdated(summaryVersion string) ([]*model.Video, error)
+	FindByFilter(filter model.VideoFilter) ([]*model.Video, error)
+	// FindStatisticsBefore returns at most limit videos with metadata and
+	// statistics that were fetched before t, or never, the oldest first
+	FindStatisticsBefore(t time.Time, limit int) ([]*model.Video, error)
+	// SaveStatistics only updates the counts, so that it does not overwrite
+	// the work of the processors
+	SaveStatistics(video *model.Video) error
+	CountByStatus() (map[model.VideoStatus]int, error)
+}
+
+// VideoEventRepository is append only
+type VideoEventRepository interface {
+	Add(event *model.VideoEvent) error
+	FindByVideo(videoID uuid.UUID) ([]*model.VideoEvent, error)
+}
+
+type UsageRepository interface {
+	Save(usage *model.LLMUsage) error
+	CostSince(since time.Time) (float64, error)
+	Summarize(group model.UsageGroup, since time.Time) ([]model.UsageSummary, error)
+}
+
+type LLMCacheRepository interface {
+	Find(key string) (*model.LLMCacheEntry, error)
+	Save(entry *model.LLMCacheEntry) error
+}
+
+// JobQueue is a durable queue that can be shared by multiple workers. A leased
+// job is invisible to other workers until it is acked, nacked or until the
+// visibility timeout has passed.
+type JobQueue interface {
+	Enqueue(queue model.Queue, subjectID uuid.UUID, priority int) error
+	Lease(queue model.Queue, max int, visibility time.Duration) ([]*model.Job, error)
+	Ack(job *model.Job) error
+	Nack(job *model.Job, jobErr error, delay time.Duration) error
+	Depth() (map[model.Queue]int, error)
+}
+
+type APIKeyRepository interface {
+	Save(key *model.APIKey) error
+	FindByHash(hash string) (*model.APIKey, error)
+	FindAll() ([]*model.APIKey, error)
+	Revoke(id uuid.UUID) error
 }
 
 type VideoVecRepository interface {
 	Save(ctx context.Context, video *model.Video) error
+	Delete(ctx context.Context, video *model.Video) error
 }
@@ -2,6 +2,7 @@ package storage
 
 import (
 	"context"
+	"fmt"
 	"net/http"
 
 	"go-mod.ewintr.nl/yogai/model"
@@ -37,6 +38,18 @@ func NewWeaviate(host, weaviateApiKey, openaiApiKey string) (*Weaviate, error) {
 	return &Weaviate{client: c}, nil
 }
 
+func (w *Weaviate) Ping(ctx context.Context) error {
+	ready, err := w.client.Misc().ReadyChecker().Do(ctx)
+	if err != nil {
+		return err
+	}
+	if !ready {
+		return fmt.Errorf("weaviate is not ready")
+	}
+
+	return nil
+}
+
 func (w *Weaviate) ResetSchema() error {
 
 	// delete old
@@ -97,3 +110,17 @@ func (w *Weaviate) Save(ctx context.Context, video *model.Video) error {
 
 	return err
 }
+
+// Delete removes the video, it is not an error if it was never saved
+func (w *Weaviate) Delete(ctx context.Context, video *model.Video) error {
+	err := w.client.Data().
+		Deleter().
+		WithID(video.ID.String()).
+		WithClassName(className).
+		Do(ctx)
+	if status, ok := err.(*fault.WeaviateClientError); ok && status.StatusCode == http.StatusNotFound {
+		return nil
+	}
+
+	return err
+}
@@ -0,0 +1,169 @@
+// Package youtubeurl finds the ids in the URLs that YouTube uses for videos,
+// channels, playlists and feeds. The functions also accept bare ids
+// and URLs without scheme.
+package youtubeurl
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"go-mod.ewintr.nl/yogai/model"
+)
+
+var ErrNotYoutube = errors.New("not a youtube url")
+
+var (
+	videoRE    = regexp.MustCompile(`^[A-Za-z0-9_-]{11}$`)
+	channelRE  = regexp.MustCompile(`^UC[A-Za-z0-9_-]{22}$`)
+	playlistRE = regexp.MustCompile(`^(PL|UU|OL|RD|FL|LL)[A-Za-z0-9_-]{10,}$`)
+)
+
+// FeedURL is the source of a YouTube RSS feed
+type FeedURL struct {
+	Source     model.FeedSource
+	ChannelID  model.YoutubeChannelID
+	PlaylistID model.YoutubePlaylistID
+}
+
+// Video returns the id in a watch, youtu.be, shorts, live or embed URL
+func Video(s string) (model.YoutubeVideoID, error) {
+	s = strings.TrimSpace(s)
+	if videoRE.MatchString(s) {
+		return model.YoutubeVideoID(s), nil
+	}
+	u, segments, err := parse(s)
+	if err != nil {
+		return "", err
+	}
+
+	id := ""
+	switch {
+	case u.Hostname() == "youtu.be":
+		id = segments[0]
+	case segments[0] == "watch":
+		id = u.Query().Get("v")
+	case len(segments) > 1 && (segments[0] == "shorts" || segments[0] == "live" || segments[0] == "embed" || segments[0] == "v"):
+		id = segments[1]
+	}
+	if !videoRE.MatchString(id) {
+		return "", fmt.Errorf("no youtube video id in %q", s)
+	}
+
+	return model.YoutubeVideoID(id), nil
+}
+
+// Channel returns the id in a channel URL or a channel feed URL. URLs with a
+// handle, like https://www.youtube.com/@name, are not accepted, the id of the
+// channel can not be read from them.
+func Channel(s string) (model.YoutubeChannelID, error) {
+	s = strings.TrimSpace(s)
+	if channelRE.MatchString(s) {
+		return model.YoutubeChannelID(s), nil
+	}
+	u, segments, err := parse(s)
+	if err != nil {
+		return "", err
+	}
+
+	id := ""
+	switch {
+	case len(segments) > 1 && segments[0] == "channel":
+		id = segments[1]
+	case isFeed(segments):
+		id = u.Query().Get("channel_id")
+	}
+	if !channelRE.MatchString(id) {
+		return "", fmt.Errorf("no youtube channel id in %q", s)
+	}
+
+	return model.YoutubeChannelID(id), nil
+}
+
+// Playlist returns the id in a playlist URL, a watch URL that plays a
+// playlist, or a playlist feed URL
+func Playlist(s string) (model.YoutubePlaylistID, error) {
+	s = strings.TrimSpace(s)
+	if playlistRE.MatchString(s) {
+		return model.YoutubePlaylistID(s), nil
+	}
+	u, segments, err := parse(s)
+	if err != nil {
+		return "", err
+	}
+
+	id := ""
+	switch {
+	case segments[0] == "playlist" || segments[0] == "watch":
+		id = u.Query().Get("list")
+	case isFeed(segments):
+		id = u.Query().Get("playlist_id")
+	}
+	if !playlistRE.MatchString(id) {
+		return "", fmt.Errorf("no youtube playlist id in %q", s)
+	}
+
+	return model.YoutubePlaylistID(id), nil
+}
+
+// Feed reads the URL of a channel or playlist RSS feed, like
+// https://www.youtube.com/feeds/videos.xml?channel_id=UC...
+func Feed(s string) (FeedURL, error) {
+	s = strings.TrimSpace(s)
+	_, segments, err := parse(s)
+	if err != nil {
+		return FeedURL{}, err
+	}
+	if !isFeed(segments) {
+		return FeedURL{}, fmt.Errorf("no youtube feed in %q", s)
+	}
+	if id, err := Channel(s); err == nil {
+		return FeedURL{Source: model.FeedSourceChannel, ChannelID: id}, nil
+	}
+	if id, err := Playlist(s); err == nil {
+		return FeedURL{Source: model.FeedSourcePlaylist, PlaylistID: id}, nil
+	}
+
+	return FeedURL{}, fmt.Errorf("no channel or playlist id in feed %q", s)
+}
+
+// ChannelFeed returns the URL of the RSS feed of the channel
+func ChannelFeed(id model.YoutubeChannelID) string {
+	return "https://www.youtube.com/feeds/videos.xml?channel_id=" + url.QueryEscape(string(id))
+}
+
+// PlaylistFeed returns the URL of the RSS feed of the playlist
+func PlaylistFeed(id model.YoutubePlaylistID) string {
+	return "https://www.youtube.com/feeds/videos.xml?playlist_id=" + url.QueryEscape(string(id))
+}
+
+// parse returns the URL with a normalized host and the segments of its path.
+// There is always at least one segment, it can be empty.
+func parse(s string) (*url.URL, []string, error) {
+	if !strings.Contains(s, "://") {
+		s = "https://" + s
+	}
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %q: %v", ErrNotYoutube, s, err)
+	}
+
+	host := strings.ToLower(u.Hostname())
+	for _, prefix := range []string{"www.", "m.", "music."} {
+		host = strings.TrimPrefix(host, prefix)
+	}
+	switch host {
+	case "youtube.com", "youtube-nocookie.com", "youtu.be":
+	default:
+		return nil, nil, fmt.Errorf("%w: %q", ErrNotYoutube, s)
+	}
+	u.Host = host
+
+	return u, strings.Split(strings.Trim(u.Path, "/"), "/"), nil
+}
+
+func isFeed(segments []string) bool {
+	return len(segments) == 2 && segments[0] == "feeds" && segments[1] == "videos.xml"
+}
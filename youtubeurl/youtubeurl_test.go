@@ -0,0 +1,168 @@
+package youtubeurl
+
+import (
+	"errors"
+	"testing"
+
+	"go-mod.ewintr.nl/yogai/model"
+)
+
+func TestVideo(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		input  string
+		exp    model.YoutubeVideoID
+		expErr bool
+		notYT  bool
+	}{
+		{name: "bare id", input: "dQw4w9WgXcQ", exp: "dQw4w9WgXcQ"},
+		{name: "bare id with spaces", input: "  dQw4w9WgXcQ\n", exp: "dQw4w9WgXcQ"},
+		{name: "watch", input: "https://www.youtube.com/watch?v=dQw4w9WgXcQ", exp: "dQw4w9WgXcQ"},
+		{name: "watch with time", input: "https://www.youtube.com/watch?v=dQw4w9WgXcQ&t=42s", exp: "dQw4w9WgXcQ"},
+		{name: "watch with playlist", input: "https://www.youtube.com/watch?v=dQw4w9WgXcQ&list=PLFgquLnL59alCl_2TQvOiD5Vgm1hCaGSI&index=2", exp: "dQw4w9WgXcQ"},
+		{name: "no scheme", input: "youtube.com/watch?v=dQw4w9WgXcQ", exp: "dQw4w9WgXcQ"},
+		{name: "http", input: "http://youtube.com/watch?v=dQw4w9WgXcQ", exp: "dQw4w9WgXcQ"},
+		{name: "mobile", input: "https://m.youtube.com/watch?v=dQw4w9WgXcQ", exp: "dQw4w9WgXcQ"},
+		{name: "music", input: "https://music.youtube.com/watch?v=dQw4w9WgXcQ&feature=share", exp: "dQw4w9WgXcQ"},
+		{name: "upper case host", input: "https://WWW.YouTube.com/watch?v=dQw4w9WgXcQ", exp: "dQw4w9WgXcQ"},
+		{name: "short link", input: "https://youtu.be/dQw4w9WgXcQ", exp: "dQw4w9WgXcQ"},
+		{name: "short link with time", input: "https://youtu.be/dQw4w9WgXcQ?t=42", exp: "dQw4w9WgXcQ"},
+		{name: "shorts", input: "https://www.youtube.com/shorts/dQw4w9WgXcQ", exp: "dQw4w9WgXcQ"},
+		{name: "shorts with trailing slash", input: "https://youtube.com/shorts/dQw4w9WgXcQ/?feature=share", exp: "dQw4w9WgXcQ"},
+		{name: "live", input: "https://www.youtube.com/live/dQw4w9WgXcQ?si=abc", exp: "dQw4w9WgXcQ"},
+		{name: "embed", input: "https://www.youtube.com/embed/dQw4w9WgXcQ?start=10", exp: "dQw4w9WgXcQ"},
+		{name: "embed no cookie", input: "https://www.youtube-nocookie.com/embed/dQw4w9WgXcQ", exp: "dQw4w9WgXcQ"},
+		{name: "old v path", input: "https://www.youtube.com/v/dQw4w9WgXcQ", exp: "dQw4w9WgXcQ"},
+		{name: "empty", input: "", expErr: true, notYT: true},
+		{name: "too short id", input: "dQw4w9WgXc", expErr: true, notYT: true},
+		{name: "watch without id", input: "https://www.youtube.com/watch", expErr: true},
+		{name: "watch with invalid id", input: "https://www.youtube.com/watch?v=dQw4w9WgXcQQ", expErr: true},
+		{name: "channel", input: "https://www.youtube.com/channel/UCuAXFkgsw1L7xaCfnd5JJOw", expErr: true},
+		{name: "playlist", input: "https://www.youtube.com/playlist?list=PLFgquLnL59alCl_2TQvOiD5Vgm1hCaGSI", expErr: true},
+		{name: "other host", input: "https://vimeo.com/watch?v=dQw4w9WgXcQ", expErr: true, notYT: true},
+		{name: "lookalike host", input: "https://youtube.com.example.org/watch?v=dQw4w9WgXcQ", expErr: true, notYT: true},
+		{name: "malformed", input: "https://www.youtube.com/watch?v=%zz", expErr: true},
+		{name: "malformed host", input: "http://[::1", expErr: true, notYT: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			act, err := Video(tc.input)
+			checkErr(t, err, tc.expErr, tc.notYT)
+			if act != tc.exp {
+				t.Errorf("exp %q, got %q", tc.exp, act)
+			}
+		})
+	}
+}
+
+func TestChannel(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		input  string
+		exp    model.YoutubeChannelID
+		expErr bool
+		notYT  bool
+	}{
+		{name: "bare id", input: "UCuAXFkgsw1L7xaCfnd5JJOw", exp: "UCuAXFkgsw1L7xaCfnd5JJOw"},
+		{name: "channel", input: "https://www.youtube.com/channel/UCuAXFkgsw1L7xaCfnd5JJOw", exp: "UCuAXFkgsw1L7xaCfnd5JJOw"},
+		{name: "channel tab", input: "https://www.youtube.com/channel/UCuAXFkgsw1L7xaCfnd5JJOw/videos", exp: "UCuAXFkgsw1L7xaCfnd5JJOw"},
+		{name: "mobile", input: "m.youtube.com/channel/UCuAXFkgsw1L7xaCfnd5JJOw", exp: "UCuAXFkgsw1L7xaCfnd5JJOw"},
+		{name: "feed", input: "https://www.youtube.com/feeds/videos.xml?channel_id=UCuAXFkgsw1L7xaCfnd5JJOw", exp: "UCuAXFkgsw1L7xaCfnd5JJOw"},
+		{name: "handle", input: "https://www.youtube.com/@yogawithadriene", expErr: true},
+		{name: "invalid id", input: "https://www.youtube.com/channel/UCshort", expErr: true},
+		{name: "playlist feed", input: "https://www.youtube.com/feeds/videos.xml?playlist_id=PLFgquLnL59alCl_2TQvOiD5Vgm1hCaGSI", expErr: true},
+		{name: "other host", input: "https://example.com/channel/UCuAXFkgsw1L7xaCfnd5JJOw", expErr: true, notYT: true},
+		{name: "empty", input: "", expErr: true, notYT: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			act, err := Channel(tc.input)
+			checkErr(t, err, tc.expErr, tc.notYT)
+			if act != tc.exp {
+				t.Errorf("exp %q, got %q", tc.exp, act)
+			}
+		})
+	}
+}
+
+func TestPlaylist(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		input  string
+		exp    model.YoutubePlaylistID
+		expErr bool
+		notYT  bool
+	}{
+		{name: "bare id", input: "PLFgquLnL59alCl_2TQvOiD5Vgm1hCaGSI", exp: "PLFgquLnL59alCl_2TQvOiD5Vgm1hCaGSI"},
+		{name: "uploads id", input: "UUuAXFkgsw1L7xaCfnd5JJOw", exp: "UUuAXFkgsw1L7xaCfnd5JJOw"},
+		{name: "playlist", input: "https://www.youtube.com/playlist?list=PLFgquLnL59alCl_2TQvOiD5Vgm1hCaGSI", exp: "PLFgquLnL59alCl_2TQvOiD5Vgm1hCaGSI"},
+		{name: "music", input: "https://music.youtube.com/playlist?list=PLFgquLnL59alCl_2TQvOiD5Vgm1hCaGSI", exp: "PLFgquLnL59alCl_2TQvOiD5Vgm1hCaGSI"},
+		{name: "watch in playlist", input: "https://www.youtube.com/watch?v=dQw4w9WgXcQ&list=PLFgquLnL59alCl_2TQvOiD5Vgm1hCaGSI&t=5", exp: "PLFgquLnL59alCl_2TQvOiD5Vgm1hCaGSI"},
+		{name: "feed", input: "https://www.youtube.com/feeds/videos.xml?playlist_id=PLFgquLnL59alCl_2TQvOiD5Vgm1hCaGSI", exp: "PLFgquLnL59alCl_2TQvOiD5Vgm1hCaGSI"},
+		{name: "watch without playlist", input: "https://www.youtube.com/watch?v=dQw4w9WgXcQ", expErr: true},
+		{name: "invalid id", input: "https://www.youtube.com/playlist?list=XX123", expErr: true},
+		{name: "short link", input: "https://youtu.be/dQw4w9WgXcQ", expErr: true},
+		{name: "other host", input: "https://example.com/playlist?list=PLFgquLnL59alCl_2TQvOiD5Vgm1hCaGSI", expErr: true, notYT: true},
+		{name: "empty", input: "", expErr: true, notYT: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			act, err := Playlist(tc.input)
+			checkErr(t, err, tc.expErr, tc.notYT)
+			if act != tc.exp {
+				t.Errorf("exp %q, got %q", tc.exp, act)
+			}
+		})
+	}
+}
+
+func TestFeed(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		input  string
+		exp    FeedURL
+		expErr bool
+		notYT  bool
+	}{
+		{
+			name:  "channel",
+			input: "https://www.youtube.com/feeds/videos.xml?channel_id=UCuAXFkgsw1L7xaCfnd5JJOw",
+			exp:   FeedURL{Source: model.FeedSourceChannel, ChannelID: "UCuAXFkgsw1L7xaCfnd5JJOw"},
+		},
+		{
+			name:  "playlist",
+			input: "https://www.youtube.com/feeds/videos.xml?playlist_id=PLFgquLnL59alCl_2TQvOiD5Vgm1hCaGSI",
+			exp:   FeedURL{Source: model.FeedSourcePlaylist, PlaylistID: "PLFgquLnL59alCl_2TQvOiD5Vgm1hCaGSI"},
+		},
+		{
+			name:  "no scheme",
+			input: "youtube.com/feeds/videos.xml?channel_id=UCuAXFkgsw1L7xaCfnd5JJOw",
+			exp:   FeedURL{Source: model.FeedSourceChannel, ChannelID: "UCuAXFkgsw1L7xaCfnd5JJOw"},
+		},
+		{
+			name:  "own feed urls",
+			input: ChannelFeed("UCuAXFkgsw1L7xaCfnd5JJOw"),
+			exp:   FeedURL{Source: model.FeedSourceChannel, ChannelID: "UCuAXFkgsw1L7xaCfnd5JJOw"},
+		},
+		{name: "user feed", input: "https://www.youtube.com/feeds/videos.xml?user=yogawithadriene", expErr: true},
+		{name: "invalid channel id", input: "https://www.youtube.com/feeds/videos.xml?channel_id=UCshort", expErr: true},
+		{name: "channel page", input: "https://www.youtube.com/channel/UCuAXFkgsw1L7xaCfnd5JJOw", expErr: true},
+		{name: "other feed", input: "https://blog.example.com/feed.xml", expErr: true, notYT: true},
+		{name: "empty", input: "", expErr: true, notYT: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			act, err := Feed(tc.input)
+			checkErr(t, err, tc.expErr, tc.notYT)
+			if act != tc.exp {
+				t.Errorf("exp %+v, got %+v", tc.exp, act)
+			}
+		})
+	}
+}
+
+func checkErr(t *testing.T, err error, expErr, notYT bool) {
+	t.Helper()
+	if expErr != (err != nil) {
+		t.Fatalf("exp error %v, got %v", expErr, err)
+	}
+	if notYT != errors.Is(err, ErrNotYoutube) {
+		t.Errorf("exp ErrNotYoutube %v, got %v", notYT, err)
+	}
+}